@@ -1,48 +1,204 @@
 // Package main is an entrypoint to fullstack exposing a list of items to be done.
-// It uses no dependencies aside from SQL connector implementation, since a standard library provides just the interface (like JDBC in Java).
+// It uses no dependencies aside from SQL connector implementation, since a standard library provides just the interface (like JDBC in Java),
+// bcrypt for hashing the passwords of the users, parsers of TOML and YAML config files and brotli for precompressing the static assets.
+//
+// The schema of the database is migrated on startup. It can also be managed with: fullstack migrate up|down|status
+// Tasks created before the accounts were introduced are hidden until a user claims them with: fullstack migrate claim NAME
+// Tasks can be kept in memory instead of the database with: fullstack -storage=memory
+// Metrics are exposed in the text format of Prometheus at /metrics.
+// Changes of the tasks are streamed as Server-Sent Events at /api/events, the open pages update themselves from /events.
+//
+// Settings are read from a config file given with -config, environment variables like TODOS_DB_PATH and flags,
+// see package config. The effective configuration is printed with: fullstack -print-config
 package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	"todo/internal/config"
 	"todo/internal/data"
+	"todo/internal/logging"
+	"todo/internal/memory"
+	"todo/internal/metrics"
 	"todo/internal/server"
 	"todo/internal/todo"
+
+	// deadlines are entered in the user's time zone, which may be missing on the host
+	_ "time/tzdata"
 )
 
 func main() {
-	ctx := gracefulShutdown()
+	cfg, opts, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 
-	storage, err := data.NewSQLiteTaskStorage("./todos.db")
 	if err != nil {
-		slog.Error("failed to create SQLite storage", slog.String("err", err.Error()))
-		return
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	err = cfg.Validate()
+	if opts.PrintConfig {
+		if perr := cfg.Print(os.Stdout); perr != nil {
+			fmt.Fprintln(os.Stderr, perr)
+			os.Exit(1)
+		}
 	}
 
-	err = storage.Initialize()
 	if err != nil {
-		slog.Error("failed to initialize SQLite storage", slog.String("err", err.Error()))
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%s\n", err)
+		os.Exit(2)
+	}
+
+	if opts.PrintConfig {
 		return
 	}
 
-	handler := todo.NewHandler(storage)
-	s, err := server.NewHttp(nil, handler, storage)
-	if err != nil {
-		slog.ErrorContext(ctx, "creating the server: %w", err)
+	level, _ := cfg.Log.SlogLevel()
+	logs := newLogHandler(cfg.Log.Format, level)
+	// records logged with the context of a request carry its id, see logging.WithAttrs
+	slog.SetDefault(slog.New(logging.NewHandler(logs)))
+	ctx := gracefulShutdown()
+	if len(opts.File) != 0 {
+		slog.InfoContext(ctx, "loaded the configuration", slog.String("file", opts.File))
+	}
+
+	if args := opts.Args; len(args) > 0 && args[0] == "migrate" {
+		sqlite, err := data.NewSQLiteTaskStorage(cfg.DBPath)
+		if err != nil {
+			slog.Error("failed to create SQLite storage", logging.Err(err))
+			os.Exit(1)
+		}
+
+		err = migrate(ctx, os.Stdout, sqlite, args[1:])
+		if err != nil {
+			slog.Error("failed to migrate SQLite storage", logging.Err(err))
+			os.Exit(1)
+		}
 		return
 	}
 
+	reg := metrics.NewRegistry()
+	storage, err := newStorage(cfg, reg)
+	if err != nil {
+		slog.Error("failed to create the storage", slog.String("kind", cfg.Storage), logging.Err(err))
+		os.Exit(1)
+	}
+
+	registerMetrics(reg, storage)
+	handler := todo.NewHandler(storage, storage, storage)
+	httpCfg := &server.HttpCfg{
+		Address:           cfg.Address,
+		StaticDir:         cfg.StaticDir,
+		CertFile:          cfg.TLS.CertFile,
+		KeyFile:           cfg.TLS.KeyFile,
+		ReadHeaderTimeout: time.Duration(cfg.Timeouts.ReadHeader),
+		ReadTimeout:       time.Duration(cfg.Timeouts.Read),
+		WriteTimeout:      time.Duration(cfg.Timeouts.Write),
+		IdleTimeout:       time.Duration(cfg.Timeouts.Idle),
+		ShutdownTimeout:   time.Duration(cfg.Timeouts.Shutdown),
+		MaxHeaderBytes:    cfg.Limits.MaxHeaderBytes,
+		MaxBodyBytes:      cfg.Limits.MaxBodyBytes,
+		DisableSignup:     !cfg.Features.Signup,
+		DisableMetrics:    !cfg.Features.Metrics,
+		Metrics:           reg,
+	}
+	if r, ok := storage.(readiness); ok {
+		httpCfg.Ready = r.Ready
+	}
+
+	s, err := server.NewHttp(httpCfg, handler)
+	if err != nil {
+		slog.ErrorContext(ctx, "creating the server", logging.Err(err))
+		os.Exit(1)
+	}
+
 	err = s.Start(ctx)
 	if err != nil {
-		slog.ErrorContext(ctx, "failed to start a server", slog.String("err", err.Error()))
-		return
+		slog.ErrorContext(ctx, "running the server", logging.Err(err))
+		os.Exit(1)
 	}
 }
 
+// storage keeps the tasks with their history, the lists they belong to and the users who own them
+type storage interface {
+	todo.Storage
+	todo.TaskCounter
+	todo.HistoryStorage
+	todo.ListStorage
+	todo.UserStorage
+}
+
+// readiness is implemented by the storages, which depend on an external resource, like the SQLite database
+type readiness interface {
+	Ready(ctx context.Context) error
+}
+
+// newStorage returns the storage of the configured kind, SQLite one records the timings of its operations in the metrics.
+func newStorage(cfg config.Config, reg *metrics.Registry) (storage, error) {
+	switch cfg.Storage {
+	case "memory":
+		return memory.NewTaskStorage(), nil
+	case "sqlite":
+		storage, err := data.NewSQLiteTaskStorage(cfg.DBPath)
+		if err != nil {
+			return nil, fmt.Errorf("creating SQLite storage, %w", err)
+		}
+
+		storage.Instrument(reg)
+		err = storage.Initialize()
+		if err != nil {
+			return nil, fmt.Errorf("initializing SQLite storage, %w", err)
+		}
+
+		n, err := storage.Unclaimed(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("counting unclaimed tasks, %w", err)
+		}
+
+		if n > 0 {
+			slog.Warn("tasks created before the accounts are hidden, claim them with: fullstack migrate claim NAME", slog.Int("tasks", n))
+		}
+
+		return storage, nil
+	default:
+		return nil, fmt.Errorf("unknown storage: %s", cfg.Storage)
+	}
+}
+
+// registerMetrics registers the stats of the runtime and the number of tasks, which is counted on every scrape.
+func registerMetrics(reg *metrics.Registry, s todo.TaskCounter) {
+	metrics.RegisterRuntime(reg)
+	reg.GaugeFunc("todo_tasks", "Number of tasks of all the users by their done state.", []string{"done"}, func(ctx context.Context, set func(v float64, labelValues ...string)) error {
+		done, undone, err := s.CountTasks(ctx)
+		if err != nil {
+			return err
+		}
+
+		set(float64(done), "true")
+		set(float64(undone), "false")
+		return nil
+	})
+}
+
+// newLogHandler returns the handler of the format, which is already validated, see config.Config.Validate.
+func newLogHandler(format string, level slog.Level) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.NewJSONHandler(os.Stderr, opts)
+	}
+
+	return slog.NewTextHandler(os.Stderr, opts)
+}
+
 // listens for SIGINT and SIGTERM and cancels context if received
 func gracefulShutdown() context.Context {
 	ctx, cancel := context.WithCancelCause(context.Background())
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"todo/internal/data"
+)
+
+const migrateUsage = `usage: fullstack migrate <command>
+
+commands:
+  up          applies all pending migrations
+  down [n]    reverts n most recently applied migrations, 1 by default
+  status      lists all migrations
+  claim NAME  gives the tasks created before the accounts were introduced to the user NAME,
+              nobody can see them until they are claimed`
+
+// migrate runs a subcommand managing the schema of the database, see migrateUsage.
+func migrate(ctx context.Context, out io.Writer, s *data.SQLiteTaskStorage, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		return s.MigrateUp(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("number of migrations to revert must be a positive number, got: %s", args[1])
+			}
+			steps = n
+		}
+		return s.MigrateDown(ctx, steps)
+	case "status":
+		status, err := s.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		return printMigrationStatus(out, status)
+	case "claim":
+		if len(args) != 2 {
+			return fmt.Errorf("claim expects the name of the user\n%s", migrateUsage)
+		}
+
+		n, err := s.Claim(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(out, "claimed %d tasks for: %s\n", n, args[1])
+		return err
+	default:
+		return fmt.Errorf("unknown command: %s\n%s", args[0], migrateUsage)
+	}
+}
+
+func printMigrationStatus(out io.Writer, status []data.MigrationStatus) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, st := range status {
+		applied := "pending"
+		if st.AppliedAt != nil {
+			applied = st.AppliedAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, st.Name, applied)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,325 @@
+// Package config loads the configuration of fullstack. Settings are layered, every layer overrides the previous one:
+// defaults, a config file (TOML, YAML or JSON), environment variables prefixed with TODOS_ and command line flags.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Address string `json:"address" toml:"address" yaml:"address"`
+	// Storage is either sqlite or memory, the tasks in memory are lost on exit
+	Storage string `json:"storage" toml:"storage" yaml:"storage"`
+	DBPath  string `json:"db_path" toml:"db_path" yaml:"db_path"`
+	// StaticDir replaces the scripts and styles embedded in the binary, e.g. while editing them
+	StaticDir string   `json:"static_dir" toml:"static_dir" yaml:"static_dir"`
+	Log       Log      `json:"log" toml:"log" yaml:"log"`
+	Timeouts  Timeouts `json:"timeouts" toml:"timeouts" yaml:"timeouts"`
+	TLS       TLS      `json:"tls" toml:"tls" yaml:"tls"`
+	Limits    Limits   `json:"limits" toml:"limits" yaml:"limits"`
+	Features  Features `json:"features" toml:"features" yaml:"features"`
+}
+
+type Log struct {
+	// Level is one of debug, info, warn or error
+	Level string `json:"level" toml:"level" yaml:"level"`
+	// Format is either text or json, e.g. for shipping to an aggregator
+	Format string `json:"format" toml:"format" yaml:"format"`
+}
+
+// Timeouts of the HTTP server, they protect it from clients holding connections open.
+type Timeouts struct {
+	ReadHeader Duration `json:"read_header" toml:"read_header" yaml:"read_header"`
+	Read       Duration `json:"read" toml:"read" yaml:"read"`
+	Write      Duration `json:"write" toml:"write" yaml:"write"`
+	Idle       Duration `json:"idle" toml:"idle" yaml:"idle"`
+	// Shutdown is how long the requests in progress can take on exit, before their connections are closed
+	Shutdown Duration `json:"shutdown" toml:"shutdown" yaml:"shutdown"`
+}
+
+// Limits of the size of the requests.
+type Limits struct {
+	MaxHeaderBytes int   `json:"max_header_bytes" toml:"max_header_bytes" yaml:"max_header_bytes"`
+	MaxBodyBytes   int64 `json:"max_body_bytes" toml:"max_body_bytes" yaml:"max_body_bytes"`
+}
+
+// TLS is enabled when both files are set.
+type TLS struct {
+	CertFile string `json:"cert_file" toml:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" toml:"key_file" yaml:"key_file"`
+}
+
+// Features can be turned off, e.g. to run a private instance.
+type Features struct {
+	// Signup lets anyone register an account
+	Signup bool `json:"signup" toml:"signup" yaml:"signup"`
+	// Metrics are exposed at /metrics
+	Metrics bool `json:"metrics" toml:"metrics" yaml:"metrics"`
+}
+
+func Default() Config {
+	return Config{
+		Address: ":3456",
+		Storage: "sqlite",
+		DBPath:  "./todos.db",
+		Log:     Log{Level: "info", Format: "text"},
+		Timeouts: Timeouts{
+			ReadHeader: Duration(5 * time.Second),
+			Read:       Duration(30 * time.Second),
+			Write:      Duration(60 * time.Second),
+			Idle:       Duration(2 * time.Minute),
+			Shutdown:   Duration(10 * time.Second),
+		},
+		Limits:   Limits{MaxHeaderBytes: 64 << 10, MaxBodyBytes: 1 << 20},
+		Features: Features{Signup: true, Metrics: true},
+	}
+}
+
+// Duration is written as a text, like 5s or 1m30s, in the config file.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	parsed, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// String and Set make Duration a flag.Value.
+func (d *Duration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *Duration) Set(s string) error {
+	return d.UnmarshalText([]byte(s))
+}
+
+// Options of a single run, which are not part of the configuration.
+type Options struct {
+	// File the configuration was read from, empty if none
+	File string
+	// PrintConfig prints the effective configuration instead of running
+	PrintConfig bool
+	// Args are left after the flags, e.g. a subcommand
+	Args []string
+}
+
+// envPrefix of the environment variables, which are named after the flags, e.g. TODOS_DB_PATH for -db-path
+const envPrefix = "TODOS_"
+
+// Load returns the configuration layered from the defaults, the file given with -config flag or TODOS_CONFIG variable,
+// the environment variables and the flags in args. It does not validate the configuration, see Config.Validate.
+func Load(args []string, getenv func(string) string) (Config, Options, error) {
+	cfg := Default()
+	opts := Options{}
+	fs := flag.NewFlagSet("fullstack", flag.ContinueOnError)
+	fs.StringVar(&opts.File, "config", getenv(envPrefix+"CONFIG"), "config file: .toml, .yaml, .yml or .json (env "+envPrefix+"CONFIG)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration as JSON and exit")
+	cfg.bind(fs)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, Options{}, err
+	}
+	opts.Args = fs.Args()
+
+	// flags are bound to cfg, they are set again on top of the other layers
+	set := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = f.Value.String() })
+	cfg = Default()
+
+	if len(opts.File) != 0 {
+		err = cfg.readFile(opts.File)
+		if err != nil {
+			return Config{}, Options{}, err
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+
+		name := envName(f.Name)
+		if v := getenv(name); len(v) != 0 {
+			if err := f.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("environment variable: %s, %w", name, err))
+			}
+		}
+	})
+
+	for name, v := range set {
+		// values were already parsed once, they can not fail
+		_ = fs.Set(name, v)
+	}
+
+	return cfg, opts, errors.Join(errs...)
+}
+
+// bind registers the flags writing to the fields of the config
+func (c *Config) bind(fs *flag.FlagSet) {
+	fs.StringVar(&c.Address, "address", c.Address, "address the server listens on")
+	fs.StringVar(&c.Storage, "storage", c.Storage, "where the tasks are kept: sqlite or memory (lost on exit, for demos)")
+	fs.StringVar(&c.DBPath, "db-path", c.DBPath, "file of the SQLite database")
+	fs.StringVar(&c.StaticDir, "static-dir", c.StaticDir, "directory replacing the embedded scripts and styles of the UI, read on startup")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "minimal level of the logs: debug, info, warn or error")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "format of the logs: text or json (for shipping to an aggregator)")
+	fs.Var(&c.Timeouts.ReadHeader, "read-header-timeout", "time to read the headers of a request")
+	fs.Var(&c.Timeouts.Read, "read-timeout", "time to read a whole request")
+	fs.Var(&c.Timeouts.Write, "write-timeout", "time to write a response")
+	fs.Var(&c.Timeouts.Idle, "idle-timeout", "time to keep an idle connection open")
+	fs.Var(&c.Timeouts.Shutdown, "shutdown-timeout", "time for the requests in progress to finish on exit")
+	fs.IntVar(&c.Limits.MaxHeaderBytes, "max-header-bytes", c.Limits.MaxHeaderBytes, "maximal size of the headers of a request")
+	fs.Int64Var(&c.Limits.MaxBodyBytes, "max-body-bytes", c.Limits.MaxBodyBytes, "maximal size of the body of a request")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "certificate file, serves HTTPS along with -tls-key")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "private key file of the certificate")
+	fs.BoolVar(&c.Features.Signup, "signup", c.Features.Signup, "let anyone register an account")
+	fs.BoolVar(&c.Features.Metrics, "metrics", c.Features.Metrics, "expose the metrics at /metrics")
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// readFile decodes the file on top of the config, keys missing in the file keep their values.
+// Unknown keys are reported, so a typo does not silently leave the default in place.
+func (c *Config) readFile(file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("reading config file: %s, %w", file, err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".toml":
+		var md toml.MetaData
+		md, err = toml.Decode(string(b), c)
+		if err == nil && len(md.Undecoded()) != 0 {
+			err = fmt.Errorf("unknown keys: %v", md.Undecoded())
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+		// an empty file has no document
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(c)
+	default:
+		err = fmt.Errorf("unsupported format: %q, use .toml, .yaml, .yml or .json", ext)
+	}
+
+	if err != nil {
+		return fmt.Errorf("parsing config file: %s, %w", file, err)
+	}
+
+	return nil
+}
+
+// Validate reports all the invalid settings at once.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		invalid("address: %q must be host:port, %w", c.Address, err)
+	}
+
+	switch c.Storage {
+	case "sqlite":
+		if len(c.DBPath) == 0 {
+			invalid("db_path must not be empty with sqlite storage")
+		}
+	case "memory":
+	default:
+		invalid("storage: %q must be sqlite or memory", c.Storage)
+	}
+
+	if _, err := c.Log.SlogLevel(); err != nil {
+		invalid("log.level: %q must be debug, info, warn or error", c.Log.Level)
+	}
+
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		invalid("log.format: %q must be text or json", c.Log.Format)
+	}
+
+	for _, t := range []struct {
+		name string
+		d    Duration
+	}{
+		{"read_header", c.Timeouts.ReadHeader},
+		{"read", c.Timeouts.Read},
+		{"write", c.Timeouts.Write},
+		{"idle", c.Timeouts.Idle},
+		{"shutdown", c.Timeouts.Shutdown},
+	} {
+		if t.d <= 0 {
+			invalid("timeouts.%s: %s must be positive", t.name, time.Duration(t.d))
+		}
+	}
+
+	if c.Limits.MaxHeaderBytes <= 0 {
+		invalid("limits.max_header_bytes: %d must be positive", c.Limits.MaxHeaderBytes)
+	}
+
+	if c.Limits.MaxBodyBytes <= 0 {
+		invalid("limits.max_body_bytes: %d must be positive", c.Limits.MaxBodyBytes)
+	}
+
+	if info, err := os.Stat(c.StaticDir); len(c.StaticDir) != 0 && (err != nil || !info.IsDir()) {
+		invalid("static_dir: %q must be a directory", c.StaticDir)
+	}
+
+	if (len(c.TLS.CertFile) == 0) != (len(c.TLS.KeyFile) == 0) {
+		invalid("tls.cert_file and tls.key_file must be set together")
+	}
+
+	for _, file := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+		if _, err := os.Stat(file); len(file) != 0 && err != nil {
+			invalid("tls: %w", err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SlogLevel parses the level of the logs.
+func (l Log) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(l.Level))
+	return level, err
+}
+
+// Print writes the configuration as JSON, e.g. to check how the layers were combined.
+func (c Config) Print(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c)
+}
@@ -0,0 +1,122 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"todo/internal/config"
+)
+
+func Test_Load_Layers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "todos.toml")
+	err := os.WriteFile(file, []byte(`
+address = "127.0.0.1:8080"
+db_path = "/var/lib/todos.db"
+
+[log]
+level = "debug"
+
+[timeouts]
+read = "10s"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"TODOS_CONFIG":       file,
+		"TODOS_DB_PATH":      "/data/todos.db",
+		"TODOS_ADDRESS":      "127.0.0.1:9090",
+		"TODOS_SIGNUP":       "false",
+		"TODOS_IDLE_TIMEOUT": "1m",
+	}
+	cfg, opts, err := config.Load([]string{"-address=:7070", "migrate", "up"}, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := config.Default()
+	expected.Address = ":7070"         // flag overrides env and file
+	expected.DBPath = "/data/todos.db" // env overrides file
+	expected.Log.Level = "debug"       // file overrides default
+	expected.Timeouts.Read = config.Duration(10 * time.Second)
+	expected.Timeouts.Idle = config.Duration(time.Minute)
+	expected.Features.Signup = false
+	if cfg != expected {
+		t.Errorf("expected: %+v, got: %+v", expected, cfg)
+	}
+
+	if opts.File != file || strings.Join(opts.Args, " ") != "migrate up" {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+}
+
+func Test_Load_Formats(t *testing.T) {
+	for name, tc := range map[string]struct {
+		content string
+		err     string
+	}{
+		"todos.toml":   {content: "storage = \"memory\"\n[timeouts]\nwrite = \"3s\"\n"},
+		"todos.yaml":   {content: "storage: memory\ntimeouts:\n  write: 3s\n"},
+		"todos.json":   {content: `{"storage": "memory", "timeouts": {"write": "3s"}}`},
+		"typo.toml":    {content: "storag = \"memory\"\n", err: "unknown keys"},
+		"typo.yml":     {content: "storag: memory\n", err: "storag"},
+		"typo.json":    {content: `{"storag": "memory"}`, err: "storag"},
+		"todos.ini":    {content: "storage=memory", err: "unsupported format"},
+		"invalid.json": {content: `{"timeouts": {"write": "soon"}}`, err: "soon"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(file, []byte(tc.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, _, err := config.Load([]string{"-config", file}, func(string) string { return "" })
+			if len(tc.err) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Errorf("expected error containing: %s, got: %v", tc.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.Storage != "memory" || cfg.Timeouts.Write != config.Duration(3*time.Second) || cfg.Address != config.Default().Address {
+				t.Errorf("unexpected config: %+v", cfg)
+			}
+		})
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	valid := config.Default()
+	valid.StaticDir = t.TempDir()
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected defaults to be valid, %v", err)
+	}
+
+	invalid := valid
+	invalid.Address = "nowhere"
+	invalid.Storage = "postgres"
+	invalid.Log.Level = "loud"
+	invalid.Log.Format = "xml"
+	invalid.Timeouts.Read = config.Duration(-time.Second)
+	invalid.Limits.MaxBodyBytes = 0
+	invalid.StaticDir = filepath.Join(valid.StaticDir, "missing")
+	invalid.TLS.CertFile = "cert.pem"
+
+	err := invalid.Validate()
+	if err == nil {
+		t.Fatal("expected the config to be invalid")
+	}
+
+	for _, expected := range []string{"address", "storage", "log.level", "log.format", "timeouts.read", "limits.max_body_bytes", "static_dir", "tls.cert_file and tls.key_file"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error of: %s, got: %v", expected, err)
+		}
+	}
+}
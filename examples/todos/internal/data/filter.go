@@ -0,0 +1,96 @@
+package data
+
+import (
+	"strconv"
+	"strings"
+	"todo/internal/todo"
+)
+
+// noDeadline is a sort key of tasks without the deadline, so they are last in ascending order
+const noDeadline = "9223372036854775807"
+
+// sortKeys maps the sort order to the SQL expression of the key.
+// Deadlines are compared as unix time, because RFC3339 strings with different offsets do not sort chronologically.
+var sortKeys = map[todo.SortBy]string{
+	"":                  "id",
+	todo.SortByID:       "id",
+	todo.SortByTitle:    "lower(title)",
+	todo.SortByDeadline: "coalesce(unixepoch(deadline), " + noDeadline + ")",
+}
+
+// listQuery translates the filter to the SQL query with its arguments.
+func listQuery(f *todo.TaskFilter) (string, []any) {
+	if f == nil {
+		f = &todo.TaskFilter{}
+	}
+
+	var (
+		where []string
+		args  []any
+	)
+
+	if f.ID != nil {
+		where = append(where, "id = ?")
+		args = append(args, string(*f.ID))
+	}
+
+	if f.ListID != nil {
+		where = append(where, "list_id = ?")
+		args = append(args, string(*f.ListID))
+	}
+
+	if f.OwnerID != nil {
+		where = append(where, "owner_id = ?")
+		args = append(args, string(*f.OwnerID))
+	}
+
+	if f.Done != nil {
+		where = append(where, "done = ?")
+		args = append(args, *f.Done)
+	}
+
+	if f.DeadlineBefore != nil {
+		where = append(where, "unixepoch(deadline) < ?")
+		args = append(args, f.DeadlineBefore.Unix())
+	}
+
+	if f.DeadlineAfter != nil {
+		where = append(where, "unixepoch(deadline) > ?")
+		args = append(args, f.DeadlineAfter.Unix())
+	}
+
+	if len(f.TitleContains) != 0 {
+		where = append(where, "instr(lower(title), lower(?)) > 0")
+		args = append(args, f.TitleContains)
+	}
+
+	key, ok := sortKeys[f.SortBy]
+	if !ok {
+		key = sortKeys[todo.SortByID]
+	}
+
+	cmp, dir := ">", "ASC"
+	if f.Descending {
+		cmp, dir = "<", "DESC"
+	}
+
+	if f.After != nil {
+		// keyset pagination, the key of the cursor is looked up, so the client does not have to know it
+		where = append(where, "("+key+", id) "+cmp+" (SELECT "+key+", id FROM tasks WHERE id = ?)")
+		args = append(args, string(*f.After))
+	}
+
+	q := strings.Builder{}
+	q.WriteString("SELECT " + taskColumns + " FROM tasks")
+	if len(where) != 0 {
+		q.WriteString(" WHERE ")
+		q.WriteString(strings.Join(where, " AND "))
+	}
+
+	q.WriteString(" ORDER BY " + key + " " + dir + ", id " + dir)
+	if f.Limit > 0 {
+		q.WriteString(" LIMIT " + strconv.Itoa(f.Limit))
+	}
+
+	return q.String(), args
+}
@@ -0,0 +1,67 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"todo/internal/todo"
+)
+
+// record appends the changes of the task to its history, in the transaction which stored the task.
+func record(ctx context.Context, tx *sql.Tx, t todo.Task, kinds ...todo.ChangeKind) error {
+	now := time.Now()
+	for _, kind := range kinds {
+		c := todo.NewChange(ctx, kind, t, now)
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO task_history (task_id, owner_id, kind, at, actor_id, actor, title, deadline, done, version)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.TaskID, t.OwnerID, c.Kind, c.At.Format(time.RFC3339), c.ActorID, c.Actor, c.Title, fromDeadline(c.Deadline), c.Done, c.Version,
+		)
+		if err != nil {
+			return failed(ctx, "recording change: %s of task: %s, %w", kind, t.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// History returns the changes of the task in the order they were recorded.
+func (s *SQLiteTaskStorage) History(ctx context.Context, id todo.ID, owner todo.UserID) ([]todo.Change, error) {
+	defer s.measure("history")()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT task_id, kind, at, actor_id, actor, title, deadline, done, version
+		FROM task_history
+		WHERE task_id = ? AND owner_id = ?
+		ORDER BY id`, id, owner)
+	if err != nil {
+		return nil, failed(ctx, "listing history of task: %s, %w", id, err)
+	}
+	defer rows.Close()
+
+	out := make([]todo.Change, 0)
+	for rows.Next() {
+		var (
+			c        todo.Change
+			at       string
+			deadline sql.NullString
+		)
+		err = rows.Scan(&c.TaskID, &c.Kind, &at, &c.ActorID, &c.Actor, &c.Title, &deadline, &c.Done, &c.Version)
+		if err != nil {
+			return nil, failed(ctx, "scanning change of task: %s, %w", id, err)
+		}
+
+		c.At, err = time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, failed(ctx, "parsing time of change of task: %s, %w", id, err)
+		}
+
+		c.Deadline = toDeadline(deadline)
+		out = append(out, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, failed(ctx, "iterating over history of task: %s, %w", id, err)
+	}
+
+	return out, nil
+}
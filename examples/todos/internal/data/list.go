@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"todo/internal/todo"
+)
+
+// UpsertList updates the list only if it has the same owner, a list of someone else is never overwritten.
+func (s *SQLiteTaskStorage) UpsertList(ctx context.Context, l todo.List) (todo.List, error) {
+	defer s.measure("upsert_list")()
+	ret := todo.List{}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO lists (id, name, archived, owner_id)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(id)
+		DO UPDATE SET name = excluded.name, archived = excluded.archived
+		WHERE owner_id = excluded.owner_id
+		RETURNING id, name, archived, owner_id
+	`, l.ID, l.Name, l.Archived, l.OwnerID).Scan(&ret.ID, &ret.Name, &ret.Archived, &ret.OwnerID)
+	// the only reason for not returning a row is the conflict which did not pass the owner check
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo.List{}, failed(ctx, "upserting list: %s of: %s, %w", l.ID, l.OwnerID, todo.ErrListNotFound)
+	}
+
+	if err != nil {
+		return todo.List{}, failed(ctx, "upserting list: %v, %w", l, err)
+	}
+
+	return ret, nil
+}
+
+func (s *SQLiteTaskStorage) GetList(ctx context.Context, id todo.ListID, owner todo.UserID) (todo.List, error) {
+	defer s.measure("get_list")()
+	ret := todo.List{}
+	err := s.db.QueryRowContext(ctx, `SELECT id, name, archived, owner_id FROM lists WHERE id = ? AND owner_id = ?`, id, owner).
+		Scan(&ret.ID, &ret.Name, &ret.Archived, &ret.OwnerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo.List{}, failed(ctx, "getting list by id: %s, %w", id, todo.ErrListNotFound)
+	}
+
+	if err != nil {
+		return todo.List{}, failed(ctx, "getting list by id: %s, %w", id, err)
+	}
+
+	return ret, nil
+}
+
+func (s *SQLiteTaskStorage) Lists(ctx context.Context, owner todo.UserID, archived bool) ([]todo.List, error) {
+	defer s.measure("lists")()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, archived, owner_id
+		FROM lists
+		WHERE owner_id = ? AND (? OR NOT archived)
+		ORDER BY lower(name), id
+	`, owner, archived)
+	if err != nil {
+		return nil, failed(ctx, "listing lists of: %s, archived: %t, %w", owner, archived, err)
+	}
+	defer rows.Close()
+
+	out := make([]todo.List, 0)
+	for rows.Next() {
+		l := todo.List{}
+		if err = rows.Scan(&l.ID, &l.Name, &l.Archived, &l.OwnerID); err != nil {
+			return out, failed(ctx, "scanning list from row, %w", err)
+		}
+
+		out = append(out, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, failed(ctx, "iterating over lists, %w", err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,327 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"todo/internal/todo"
+)
+
+// Migrations are pairs of files: NNNN_name.up.sql and NNNN_name.down.sql, applied in the order of NNNN.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+type migration struct {
+	version  int
+	name     string
+	up, down string
+}
+
+// MigrationStatus describes a single migration. AppliedAt is nil if the migration is pending.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+func loadMigrations() ([]migration, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("listing migration files, %w", err)
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, f := range files {
+		base := path.Base(f)
+		prefix, rest, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration file: %s has no version prefix", base)
+		}
+
+		v, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("parsing version of migration file: %s, %w", base, err)
+		}
+
+		content, err := migrationsFS.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("reading migration file: %s, %w", base, err)
+		}
+
+		m, ok := byVersion[v]
+		if !ok {
+			m = &migration{version: v}
+			byVersion[v] = m
+		}
+
+		switch {
+		case strings.HasSuffix(rest, ".up.sql"):
+			m.name = strings.TrimSuffix(rest, ".up.sql")
+			m.up = string(content)
+		case strings.HasSuffix(rest, ".down.sql"):
+			m.down = string(content)
+		default:
+			return nil, fmt.Errorf("migration file: %s is neither up nor down", base)
+		}
+	}
+
+	out := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		out = append(out, *m)
+	}
+	slices.SortFunc(out, func(a, b migration) int { return a.version - b.version })
+
+	for i, m := range out {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migrations must be numbered from 1 without gaps, expected: %d, got: %d", i+1, m.version)
+		}
+
+		if len(m.up) == 0 || len(m.down) == 0 {
+			return nil, fmt.Errorf("migration: %d must have both up and down file", m.version)
+		}
+	}
+
+	return out, nil
+}
+
+// MigrateUp applies all pending migrations in a single transaction.
+func (s *SQLiteTaskStorage) MigrateUp(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		applied, err := appliedMigrations(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.version]; ok {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx, m.up)
+			if err != nil {
+				return failed(ctx, "applying migration: %d_%s, %w", m.version, m.name, err)
+			}
+
+			_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.version, m.name, time.Now().UTC().Format(time.RFC3339))
+			if err != nil {
+				return failed(ctx, "recording migration: %d_%s, %w", m.version, m.name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// MigrateDown reverts the given number of the most recently applied migrations in a single transaction.
+func (s *SQLiteTaskStorage) MigrateDown(ctx context.Context, steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		applied, err := appliedMigrations(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+
+			_, err = tx.ExecContext(ctx, m.down)
+			if err != nil {
+				return failed(ctx, "reverting migration: %d_%s, %w", m.version, m.name, err)
+			}
+
+			_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.version)
+			if err != nil {
+				return failed(ctx, "removing record of migration: %d_%s, %w", m.version, m.name, err)
+			}
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// MigrationStatus lists all known migrations in the order they are applied.
+func (s *SQLiteTaskStorage) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []MigrationStatus
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		applied, err := appliedMigrations(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		out = make([]MigrationStatus, 0, len(migrations))
+		for _, m := range migrations {
+			st := MigrationStatus{Version: m.version, Name: m.name}
+			if at, ok := applied[m.version]; ok {
+				st.AppliedAt = &at
+			}
+			out = append(out, st)
+		}
+
+		return nil
+	})
+
+	return out, err
+}
+
+// Ready returns an error if the database is not reachable or some migrations are not applied, e.g. after rolling back.
+// Unlike MigrationStatus, it only reads, so it can be checked often.
+func (s *SQLiteTaskStorage) Ready(ctx context.Context) error {
+	err := s.db.PingContext(ctx)
+	if err != nil {
+		return failed(ctx, "pinging the database, %w", err)
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	// migrations are applied in order, so the latest one is applied only if all of them are
+	var applied int
+	err = s.db.QueryRowContext(ctx, `SELECT coalesce(max(version), 0) FROM schema_migrations`).Scan(&applied)
+	if err != nil {
+		return failed(ctx, "checking applied migrations, %w", err)
+	}
+
+	if latest := migrations[len(migrations)-1].version; applied < latest {
+		return failed(ctx, "migrations are applied up to version: %d, latest is: %d", applied, latest)
+	}
+
+	return nil
+}
+
+// Claim gives the tasks and the lists created before the accounts were introduced to the user with the name,
+// since nobody can access them until they have an owner. It returns the number of the claimed tasks
+// or todo.ErrUserNotFound if there is no such user. The changes recorded in the history are not rewritten.
+func (s *SQLiteTaskStorage) Claim(ctx context.Context, name string) (tasks int, err error) {
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		var owner todo.UserID
+		err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE name = ?`, name).Scan(&owner)
+		if errors.Is(err, sql.ErrNoRows) {
+			return failed(ctx, "getting user by name: %s, %w", name, todo.ErrUserNotFound)
+		}
+
+		if err != nil {
+			return failed(ctx, "getting user by name: %s, %w", name, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE lists SET owner_id = ? WHERE owner_id = ''`, owner)
+		if err != nil {
+			return failed(ctx, "claiming lists for: %s, %w", owner, err)
+		}
+
+		res, err := tx.ExecContext(ctx, `UPDATE tasks SET owner_id = ? WHERE owner_id = ''`, owner)
+		if err != nil {
+			return failed(ctx, "claiming tasks for: %s, %w", owner, err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return failed(ctx, "counting claimed tasks, %w", err)
+		}
+
+		tasks = int(n)
+		return nil
+	})
+
+	return tasks, err
+}
+
+// Unclaimed returns the number of tasks without an owner, see Claim.
+func (s *SQLiteTaskStorage) Unclaimed(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM tasks WHERE owner_id = ''`).Scan(&n)
+	if err != nil {
+		return 0, failed(ctx, "counting unclaimed tasks, %w", err)
+	}
+
+	return n, nil
+}
+
+// appliedMigrations creates the schema table if needed and returns versions of applied migrations with the time they were applied at.
+func appliedMigrations(ctx context.Context, tx *sql.Tx) (map[int]time.Time, error) {
+	_, err := tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return nil, failed(ctx, "creating schema migrations table, %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, failed(ctx, "listing applied migrations, %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			v  int
+			at string
+		)
+		if err = rows.Scan(&v, &at); err != nil {
+			return nil, failed(ctx, "scanning applied migration, %w", err)
+		}
+
+		parsed, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, failed(ctx, "parsing time of applied migration: %d, %w", v, err)
+		}
+		out[v] = parsed
+	}
+
+	return out, rows.Err()
+}
+
+func (s *SQLiteTaskStorage) inTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return failed(ctx, "beginning transaction, %w", err)
+	}
+
+	err = f(tx)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return failed(ctx, "rolling back transaction: %w, after error: %w", rbErr, err)
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return failed(ctx, "committing transaction, %w", err)
+	}
+
+	return nil
+}
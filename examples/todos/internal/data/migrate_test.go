@@ -0,0 +1,153 @@
+package data_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"todo/internal/data"
+	"todo/internal/todo"
+)
+
+func Test_Migrations(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.Background()
+
+	assertApplied := func(t *testing.T, expected ...bool) {
+		t.Helper()
+		status, err := s.MigrationStatus(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(status) != len(expected) {
+			t.Fatalf("expected %d migrations, got: %d", len(expected), len(status))
+		}
+
+		for i, st := range status {
+			if applied := st.AppliedAt != nil; applied != expected[i] {
+				t.Errorf("migration: %d_%s applied: %t, expected: %t", st.Version, st.Name, applied, expected[i])
+			}
+		}
+	}
+
+	assertApplied(t, true, true, true, true, true, true, true)
+	if err := s.Ready(ctx); err != nil {
+		t.Errorf("expected migrated storage to be ready, %v", err)
+	}
+
+	if err := s.MigrateDown(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, true, true, true, true, true, true, false)
+	if err := s.Ready(ctx); err == nil {
+		t.Error("expected storage with a pending migration not to be ready")
+	}
+
+	if err := s.MigrateDown(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, false, false, false, false, false, false, false)
+
+	if err := s.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+	assertApplied(t, true, true, true, true, true, true, true)
+
+	if _, err := s.Upsert(ctx, todo.Task{ID: "a", Title: "works"}); err != nil {
+		t.Errorf("storage should work after migrating down and up, %v", err)
+	}
+}
+
+// databases created before the migrations were introduced must keep their tasks
+func Test_Migrations_Legacy(t *testing.T) {
+	tt := map[string]string{
+		"initial schema": `
+			CREATE TABLE tasks (id TEXT PRIMARY KEY, title TEXT NOT NULL, done BOOLEAN NOT NULL, deadline TEXT);
+			INSERT INTO tasks (id, title, done) VALUES ('a', 'legacy', true);
+		`,
+	}
+
+	for name, schema := range tt {
+		t.Run(name, func(t *testing.T) {
+			s := legacyStorage(t, schema)
+			tasks, err := s.List(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(tasks) != 1 || tasks[0].Title != "legacy" || !tasks[0].Done || tasks[0].Version != 1 || tasks[0].ListID != todo.DefaultListID("") {
+				t.Errorf("unexpected tasks after migration: %+v", tasks)
+			}
+		})
+	}
+}
+
+// tasks created before the accounts were introduced are given to a user, who can access them afterward
+func Test_Claim(t *testing.T) {
+	s := legacyStorage(t, `
+		CREATE TABLE tasks (id TEXT PRIMARY KEY, title TEXT NOT NULL, done BOOLEAN NOT NULL, deadline TEXT);
+		INSERT INTO tasks (id, title, done) VALUES ('a', 'legacy', true), ('b', 'backlog', false);
+	`)
+	ctx := context.Background()
+
+	if n, err := s.Unclaimed(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 unclaimed tasks, got: %d, %v", n, err)
+	}
+
+	if _, err := s.Claim(ctx, "alice"); !errors.Is(err, todo.ErrUserNotFound) {
+		t.Errorf("expected: %v, got: %v", todo.ErrUserNotFound, err)
+	}
+
+	alice := todo.User{ID: "1", Name: "alice", PasswordHash: []byte("hash")}
+	if err := s.CreateUser(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := s.Claim(ctx, "Alice"); err != nil || n != 2 {
+		t.Fatalf("expected 2 claimed tasks, got: %d, %v", n, err)
+	}
+
+	owner := alice.ID
+	if tasks, err := s.List(ctx, &todo.TaskFilter{OwnerID: &owner}); err != nil || len(tasks) != 2 {
+		t.Errorf("expected alice to own the tasks, got: %+v, %v", tasks, err)
+	}
+
+	if l, err := s.GetList(ctx, todo.DefaultListID(""), alice.ID); err != nil || l.Name != "Sam's tasks" {
+		t.Errorf("expected alice to own the list of the tasks, got: %+v, %v", l, err)
+	}
+
+	if n, err := s.Unclaimed(ctx); err != nil || n != 0 {
+		t.Errorf("expected no unclaimed tasks, got: %d, %v", n, err)
+	}
+
+	if n, err := s.Claim(ctx, "alice"); err != nil || n != 0 {
+		t.Errorf("expected nothing to be claimed again, got: %d, %v", n, err)
+	}
+}
+
+// legacyStorage returns the storage of the database created by the schema, before the migrations were introduced
+func legacyStorage(t *testing.T, schema string) *data.SQLiteTaskStorage {
+	file := filepath.Join(t.TempDir(), "todos.db")
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	s, err := data.NewSQLiteTaskStorage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
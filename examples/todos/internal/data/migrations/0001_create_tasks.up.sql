@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS tasks (
+    id TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    done BOOLEAN NOT NULL,
+    deadline TEXT
+);
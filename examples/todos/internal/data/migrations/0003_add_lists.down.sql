@@ -0,0 +1,3 @@
+DROP INDEX tasks_list_id;
+ALTER TABLE tasks DROP COLUMN list_id;
+DROP TABLE lists;
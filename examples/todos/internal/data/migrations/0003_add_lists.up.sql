@@ -0,0 +1,11 @@
+CREATE TABLE lists (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    archived BOOLEAN NOT NULL DEFAULT false
+);
+
+-- existing tasks were rendered under this title, before lists were introduced
+INSERT INTO lists (id, name) VALUES ('default', 'Sam''s tasks');
+
+ALTER TABLE tasks ADD COLUMN list_id TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX tasks_list_id ON tasks (list_id);
@@ -0,0 +1,4 @@
+DROP INDEX tasks_owner_id;
+ALTER TABLE tasks DROP COLUMN owner_id;
+DROP TABLE sessions;
+DROP TABLE users;
@@ -0,0 +1,16 @@
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    password_hash BLOB NOT NULL
+);
+
+-- only hashes of the tokens are stored, the tokens themselves are known just to the browsers
+CREATE TABLE sessions (
+    token_hash TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at TEXT NOT NULL
+);
+
+-- existing tasks were created before accounts were introduced, so they have no owner
+ALTER TABLE tasks ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX tasks_owner_id ON tasks (owner_id);
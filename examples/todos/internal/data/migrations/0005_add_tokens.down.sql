@@ -0,0 +1,2 @@
+DROP INDEX tokens_user_id;
+DROP TABLE tokens;
@@ -0,0 +1,4 @@
+DROP TRIGGER task_history_no_delete;
+DROP TRIGGER task_history_no_update;
+DROP INDEX task_history_task_id;
+DROP TABLE task_history;
@@ -0,0 +1,27 @@
+-- the history outlives the tasks, so it is kept after a task is deleted and it is not referencing the tasks
+CREATE TABLE task_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id TEXT NOT NULL,
+    owner_id TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    at TEXT NOT NULL,
+    actor_id TEXT NOT NULL,
+    actor TEXT NOT NULL,
+    title TEXT NOT NULL,
+    deadline TEXT,
+    done BOOLEAN NOT NULL,
+    version INTEGER NOT NULL
+);
+
+CREATE INDEX task_history_task_id ON task_history (task_id, owner_id);
+
+-- the history is append-only, the changes are never rewritten
+CREATE TRIGGER task_history_no_update BEFORE UPDATE ON task_history
+BEGIN
+    SELECT RAISE(ABORT, 'task history is append-only');
+END;
+
+CREATE TRIGGER task_history_no_delete BEFORE DELETE ON task_history
+BEGIN
+    SELECT RAISE(ABORT, 'task history is append-only');
+END;
@@ -0,0 +1,2 @@
+DROP INDEX lists_owner_id;
+ALTER TABLE lists DROP COLUMN owner_id;
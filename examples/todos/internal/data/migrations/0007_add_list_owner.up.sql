@@ -0,0 +1,4 @@
+-- existing lists were created before accounts were introduced, so they have no owner,
+-- until they are claimed along with their tasks with: fullstack migrate claim NAME
+ALTER TABLE lists ADD COLUMN owner_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX lists_owner_id ON lists (owner_id);
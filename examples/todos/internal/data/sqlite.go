@@ -6,53 +6,82 @@ import (
 	"fmt"
 	_ "modernc.org/sqlite"
 	"time"
+	"todo/internal/logging"
+	"todo/internal/metrics"
 	"todo/internal/todo"
 )
 
 type SQLiteTaskStorage struct {
 	db *sql.DB
+	// operations measure the time of the storage operations, nil until Instrument is called
+	operations *metrics.Histogram
 }
 
 func NewSQLiteTaskStorage(file string) (*SQLiteTaskStorage, error) {
-	db, err := sql.Open("sqlite", file)
+	// concurrent writers wait for the lock instead of failing immediately with SQLITE_BUSY,
+	// write-ahead log lets readers proceed while a write is in progress,
+	// transactions take the write lock when they begin, so the ones reading before writing, like Upsert,
+	// do not fail when a concurrent write changes the snapshot they read,
+	// foreign keys are enforced, so the sessions and tokens of a deleted user are deleted along with it
+	db, err := sql.Open("sqlite", file+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("opening sqlite database from file: %s, %w", file, err)
 	}
 	return &SQLiteTaskStorage{db: db}, nil
 }
 
+// Upsert writes the task only if the stored version matches the version of the task, 0 for a new task.
+// Every write increments the version, a stale write is rejected with todo.ErrStaleTask.
 func (s *SQLiteTaskStorage) Upsert(ctx context.Context, t todo.Task) (stored todo.Task, err error) {
-	wDead := fromDeadline(t.Deadline)
-	rows, err := s.db.QueryContext(ctx, `
-			INSERT INTO tasks (id, title, deadline, done)
-			VALUES (?, ?, ?, ?)
-			ON CONFLICT(id)
-			DO UPDATE SET title = ?, deadline = ?, done = ?
-			RETURNING id, title, done, deadline
-		`,
-		t.ID, t.Title, wDead, t.Done,
-		t.Title, wDead, t.Done,
-	)
-	if err != nil {
-		return todo.Task{}, fmt.Errorf("upserting task: %v, %w", t, err)
-	}
+	defer s.measure("upsert")()
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		before, found, err := queryTask(ctx, tx, `SELECT `+taskColumns+` FROM tasks WHERE id = ?`, t.ID)
+		if err != nil {
+			return failed(ctx, "getting task: %s before upserting it, %w", t.ID, err)
+		}
 
-	if !rows.Next() {
-		return todo.Task{}, fmt.Errorf("expected to receive upserted task but no rows were returned")
-	}
+		wDead := fromDeadline(t.Deadline)
+		ret, ok, err := queryTask(ctx, tx, `
+				INSERT INTO tasks (id, title, deadline, done, list_id, owner_id, version)
+				VALUES (?, ?, ?, ?, ?, ?, 1)
+				ON CONFLICT(id)
+				DO UPDATE SET title = excluded.title, deadline = excluded.deadline, done = excluded.done, list_id = excluded.list_id, version = version + 1
+				WHERE version = ?
+				RETURNING `+taskColumns,
+			t.ID, t.Title, wDead, t.Done, t.ListID, t.OwnerID,
+			t.Version,
+		)
+		if err != nil {
+			return failed(ctx, "upserting task: %v, %w", t, err)
+		}
+
+		if !ok {
+			// the only reason for not returning a row is the conflict which did not pass the version check
+			return failed(ctx, "upserting task: %s in version: %d, %w", t.ID, t.Version, todo.ErrStaleTask)
+		}
+
+		var previous *todo.Task
+		if found {
+			previous = &before
+		}
 
-	ret, err := scanTask(rows)
+		stored = ret
+		return record(ctx, tx, ret, todo.ChangesOf(previous, ret)...)
+	})
 	if err != nil {
-		return todo.Task{}, fmt.Errorf("scanning upserted task, %w", err)
+		return todo.Task{}, err
 	}
 
-	return ret, nil
+	return stored, nil
 }
 
+// taskColumns are selected in the order expected by scanTask
+const taskColumns = "id, title, done, deadline, list_id, owner_id, version"
+
 func scanTask(rows *sql.Rows) (todo.Task, error) {
 	ret := todo.Task{}
 	retDead := sql.NullString{}
-	err := rows.Scan(&ret.ID, &ret.Title, &ret.Done, &retDead)
+	err := rows.Scan(&ret.ID, &ret.Title, &ret.Done, &retDead, &ret.ListID, &ret.OwnerID, &ret.Version)
 	if err != nil {
 		return todo.Task{}, fmt.Errorf("scanning task from row, %w", err)
 	}
@@ -75,57 +104,140 @@ func toDeadline(d sql.NullString) *time.Time {
 }
 
 func (s *SQLiteTaskStorage) List(ctx context.Context, filter *todo.TaskFilter) ([]todo.Task, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, title, done, deadline
-		FROM tasks
-		WHERE id like ?
-	`,
-		id(filter),
-	)
-
+	defer s.measure("list")()
+	query, args := listQuery(filter)
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("listing tasks with filter: %v, %w", filter, err)
+		return nil, failed(ctx, "listing tasks with filter: %v, %w", filter, err)
 	}
+	defer rows.Close()
 
 	out := make([]todo.Task, 0)
 	for rows.Next() {
-		if rows.Err() != nil {
-			return out, fmt.Errorf("iterating over results of listing tasks with filter: %v, %w", filter, err)
-		}
-
 		t, err := scanTask(rows)
 		if err != nil {
-			return out, fmt.Errorf("scanning task from row, %w", err)
+			return out, failed(ctx, "scanning task from row, %w", err)
 		}
 
 		out = append(out, t)
 	}
 
+	if err = rows.Err(); err != nil {
+		return out, failed(ctx, "iterating over results of listing tasks with filter: %v, %w", filter, err)
+	}
+
 	return out, nil
 }
 
-func id(f *todo.TaskFilter) string {
-	if f == nil {
-		return "%"
+// Toggle flips the state in a single statement, so there is no window for a concurrent update to get lost.
+func (s *SQLiteTaskStorage) Toggle(ctx context.Context, id todo.ID, version int) (toggled todo.Task, err error) {
+	defer s.measure("toggle")()
+	err = s.inTx(ctx, func(tx *sql.Tx) error {
+		ret, ok, err := queryTask(ctx, tx, `
+			UPDATE tasks
+			SET done = NOT done, version = version + 1
+			WHERE id = ? AND (? = 0 OR version = ?)
+			RETURNING `+taskColumns, id, version, version)
+		if err != nil {
+			return failed(ctx, "toggling task by id: %s, %w", id, err)
+		}
+
+		if !ok {
+			return failed(ctx, "toggling task: %s in version: %d, %w", id, version, missing(ctx, tx, id))
+		}
+
+		toggled = ret
+		return record(ctx, tx, ret, todo.ChangeToggled)
+	})
+	if err != nil {
+		return todo.Task{}, err
 	}
 
-	if f.ID == nil {
-		return "%"
+	return toggled, nil
+}
+
+func (s *SQLiteTaskStorage) Delete(ctx context.Context, id todo.ID, version int) error {
+	defer s.measure("delete")()
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		deleted, ok, err := queryTask(ctx, tx, `DELETE FROM tasks WHERE id = ? AND (? = 0 OR version = ?) RETURNING `+taskColumns, id, version, version)
+		if err != nil {
+			return failed(ctx, "deleting task by id: %s, %w", id, err)
+		}
+
+		if !ok {
+			return failed(ctx, "deleting task: %s in version: %d, %w", id, version, missing(ctx, tx, id))
+		}
+
+		return record(ctx, tx, deleted, todo.ChangeDeleted)
+	})
+}
+
+// missing tells why the task was not written: ErrTaskNotFound if there is no such task, ErrStaleTask if its version did not match.
+func missing(ctx context.Context, tx *sql.Tx, id todo.ID) error {
+	var exists bool
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM tasks WHERE id = ?)`, id).Scan(&exists)
+	switch {
+	case err != nil:
+		return fmt.Errorf("checking if task exists, %w", err)
+	case exists:
+		return todo.ErrStaleTask
+	default:
+		return todo.ErrTaskNotFound
+	}
+}
+
+// queryTask returns the task selected or returned by the query, found is false if there is no such task.
+// The rows are closed before it returns, so the transaction can run the next statement.
+func queryTask(ctx context.Context, tx *sql.Tx, query string, args ...any) (t todo.Task, found bool, err error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return todo.Task{}, false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return todo.Task{}, false, rows.Err()
+	}
+
+	t, err = scanTask(rows)
+	if err != nil {
+		return todo.Task{}, false, err
+	}
+
+	return t, true, nil
+}
+
+func (s *SQLiteTaskStorage) CountTasks(ctx context.Context) (done, undone int, err error) {
+	defer s.measure("count_tasks")()
+	err = s.db.QueryRowContext(ctx, `SELECT count(*) FILTER (WHERE done), count(*) FILTER (WHERE NOT done) FROM tasks`).Scan(&done, &undone)
+	if err != nil {
+		return 0, 0, failed(ctx, "counting tasks, %w", err)
 	}
-	return string(*f.ID)
+
+	return done, undone, nil
+}
+
+// Instrument registers the timings of the storage operations in the metrics.
+// It must be called before the storage is used.
+func (s *SQLiteTaskStorage) Instrument(r *metrics.Registry) {
+	s.operations = r.Histogram("todo_storage_operation_duration_seconds", "Time of SQLite storage operations.", metrics.DefaultBuckets, "operation")
 }
 
+// measure returns a function recording the time of the operation since the call of measure, use it with defer.
+func (s *SQLiteTaskStorage) measure(operation string) func() {
+	if s.operations == nil {
+		return func() {}
+	}
+
+	start := time.Now()
+	return func() {
+		s.operations.Observe(time.Since(start).Seconds(), operation)
+	}
+}
+
+// Initialize brings the schema of the database up to date, see MigrateUp.
 func (s *SQLiteTaskStorage) Initialize() error {
-	// create table if not exists
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS tasks (
-			id TEXT PRIMARY KEY,
-			title TEXT NOT NULL,
-			done BOOLEAN NOT NULL,
-			deadline TEXT
-		)
-	`)
-	return err
+	return s.MigrateUp(context.Background())
 }
 
 func fromDeadline(d *time.Time) sql.NullString {
@@ -135,3 +247,9 @@ func fromDeadline(d *time.Time) sql.NullString {
 
 	return sql.NullString{Valid: true, String: d.Format(time.RFC3339)}
 }
+
+// failed formats the error of a storage operation with the attributes of the context, e.g. the id of the request,
+// so they are logged even when the error is logged without the context, see logging.WrapError.
+func failed(ctx context.Context, format string, args ...any) error {
+	return logging.WrapError(ctx, fmt.Errorf(format, args...))
+}
@@ -0,0 +1,83 @@
+package data_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+	"todo/internal/data"
+	"todo/internal/todo"
+	"todo/internal/todo/todotest"
+)
+
+func newStorage(t *testing.T) *data.SQLiteTaskStorage {
+	t.Helper()
+	s, err := data.NewSQLiteTaskStorage(filepath.Join(t.TempDir(), "todos.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func Test_SQLiteTaskStorage(t *testing.T) {
+	todotest.ShouldBehaveLikeStorage(t, func(t *testing.T) todo.Storage {
+		return newStorage(t)
+	})
+}
+
+func Test_SQLiteTaskStorage_Lists(t *testing.T) {
+	todotest.ShouldBehaveLikeListStorage(t, func(t *testing.T) todo.ListStorage {
+		return newStorage(t)
+	})
+}
+
+func Test_SQLiteTaskStorage_Users(t *testing.T) {
+	todotest.ShouldBehaveLikeUserStorage(t, func(t *testing.T) todo.UserStorage {
+		return newStorage(t)
+	})
+}
+
+// the history is an audit log, so it can not be rewritten even with a direct access to the database
+func Test_SQLiteTaskStorage_HistoryIsAppendOnly(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "todos.db")
+	s, err := data.NewSQLiteTaskStorage(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Upsert(context.Background(), todo.Task{ID: "a", Title: "audited"}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, stmt := range []string{`UPDATE task_history SET title = 'forged'`, `DELETE FROM task_history`} {
+		if _, err = db.Exec(stmt); err == nil {
+			t.Errorf("expected the history to reject: %s", stmt)
+		}
+	}
+}
+
+func Test_SQLiteTaskStorage_ForeignKeys(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.Background()
+
+	err := s.CreateSession(ctx, todo.Session{TokenHash: "token", UserID: "unknown", ExpiresAt: time.Now().Add(time.Hour)}, time.Now())
+	if err == nil {
+		t.Error("expected session of unknown user to be rejected")
+	}
+}
@@ -0,0 +1,201 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"todo/internal/todo"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+func (s *SQLiteTaskStorage) CreateUser(ctx context.Context, u todo.User) error {
+	defer s.measure("create_user")()
+	_, err := s.db.ExecContext(ctx, `INSERT INTO users (id, name, password_hash) VALUES (?, ?, ?)`,
+		u.ID, u.Name, u.PasswordHash)
+	// ids are random, so the name is the only unique column which can collide
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return failed(ctx, "creating user: %s, %w", u.Name, todo.ErrUserExists)
+	}
+
+	if err != nil {
+		return failed(ctx, "creating user: %s, %w", u.Name, err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteTaskStorage) UserByName(ctx context.Context, name string) (todo.User, error) {
+	defer s.measure("user_by_name")()
+	u := todo.User{}
+	err := s.db.QueryRowContext(ctx, `SELECT id, name, password_hash FROM users WHERE name = ?`, name).
+		Scan(&u.ID, &u.Name, &u.PasswordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo.User{}, failed(ctx, "getting user by name: %s, %w", name, todo.ErrUserNotFound)
+	}
+
+	if err != nil {
+		return todo.User{}, failed(ctx, "getting user by name: %s, %w", name, err)
+	}
+
+	return u, nil
+}
+
+func (s *SQLiteTaskStorage) CreateSession(ctx context.Context, session todo.Session, now time.Time) error {
+	defer s.measure("create_session")()
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM sessions WHERE unixepoch(expires_at) <= ?`, now.Unix())
+		if err != nil {
+			return failed(ctx, "deleting expired sessions, %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+			session.TokenHash, session.UserID, session.ExpiresAt.UTC().Format(time.RFC3339))
+		if err != nil {
+			return failed(ctx, "creating session of user: %s, %w", session.UserID, err)
+		}
+
+		return nil
+	})
+}
+
+func (s *SQLiteTaskStorage) SessionUser(ctx context.Context, tokenHash string, now time.Time) (todo.User, error) {
+	defer s.measure("session_user")()
+	u := todo.User{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT u.id, u.name, u.password_hash
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = ? AND unixepoch(s.expires_at) > ?
+	`, tokenHash, now.Unix()).Scan(&u.ID, &u.Name, &u.PasswordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo.User{}, failed(ctx, "getting user of session, %w", todo.ErrSessionNotFound)
+	}
+
+	if err != nil {
+		return todo.User{}, failed(ctx, "getting user of session, %w", err)
+	}
+
+	return u, nil
+}
+
+func (s *SQLiteTaskStorage) DeleteSession(ctx context.Context, tokenHash string) error {
+	defer s.measure("delete_session")()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
+	if err != nil {
+		return failed(ctx, "deleting session, %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteTaskStorage) CreateToken(ctx context.Context, t todo.Token) error {
+	defer s.measure("create_token")()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO tokens (id, user_id, name, scope, token_hash, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, t.ID, t.UserID, t.Name, t.Scope, t.Hash, t.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return failed(ctx, "creating token: %s of user: %s, %w", t.ID, t.UserID, err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteTaskStorage) Tokens(ctx context.Context, user todo.UserID) ([]todo.Token, error) {
+	defer s.measure("tokens")()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, name, scope, token_hash, created_at
+		FROM tokens
+		WHERE user_id = ?
+		ORDER BY unixepoch(created_at), id
+	`, user)
+	if err != nil {
+		return nil, failed(ctx, "listing tokens of user: %s, %w", user, err)
+	}
+	defer rows.Close()
+
+	out := make([]todo.Token, 0)
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return out, err
+		}
+
+		out = append(out, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return out, failed(ctx, "iterating over tokens, %w", err)
+	}
+
+	return out, nil
+}
+
+func (s *SQLiteTaskStorage) TokenByHash(ctx context.Context, hash string) (todo.Token, todo.User, error) {
+	defer s.measure("token_by_hash")()
+	var (
+		t         todo.Token
+		u         todo.User
+		createdAt string
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT t.id, t.user_id, t.name, t.scope, t.token_hash, t.created_at, u.id, u.name, u.password_hash
+		FROM tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ?
+	`, hash).Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Hash, &createdAt, &u.ID, &u.Name, &u.PasswordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return todo.Token{}, todo.User{}, failed(ctx, "getting token by hash, %w", todo.ErrTokenNotFound)
+	}
+
+	if err != nil {
+		return todo.Token{}, todo.User{}, failed(ctx, "getting token by hash, %w", err)
+	}
+
+	t.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return todo.Token{}, todo.User{}, failed(ctx, "parsing creation time of token: %s, %w", t.ID, err)
+	}
+
+	return t, u, nil
+}
+
+func (s *SQLiteTaskStorage) DeleteToken(ctx context.Context, user todo.UserID, id todo.TokenID) error {
+	defer s.measure("delete_token")()
+	res, err := s.db.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = ? AND id = ?`, user, id)
+	if err != nil {
+		return failed(ctx, "deleting token: %s of user: %s, %w", id, user, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return failed(ctx, "checking if token: %s was deleted, %w", id, err)
+	}
+
+	if n == 0 {
+		return failed(ctx, "deleting token: %s of user: %s, %w", id, user, todo.ErrTokenNotFound)
+	}
+
+	return nil
+}
+
+func scanToken(rows *sql.Rows) (todo.Token, error) {
+	t := todo.Token{}
+	createdAt := ""
+	err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.Hash, &createdAt)
+	if err != nil {
+		return todo.Token{}, fmt.Errorf("scanning token from row, %w", err)
+	}
+
+	t.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return todo.Token{}, fmt.Errorf("parsing creation time of token: %s, %w", t.ID, err)
+	}
+
+	return t, nil
+}
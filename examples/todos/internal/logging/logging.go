@@ -0,0 +1,155 @@
+// Package logging adds request-scoped attributes, like the request id, to every slog record logged with the context of the request.
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+)
+
+type attrsKey struct{}
+
+// WithAttrs returns the context with the attributes, which are added to every record logged with the context.
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev := Attrs(ctx)
+	return context.WithValue(ctx, attrsKey{}, append(slices.Clip(prev), attrs...))
+}
+
+// Attrs returns the attributes added to the context with WithAttrs.
+func Attrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// Handler adds the attributes of the context to the records passed to the next handler.
+// Errors logged with Err add the attributes of the context they were wrapped with, see WrapError.
+// The attributes of the context stay at the top level of the record, even when the logger has groups, see WithGroup.
+type Handler struct {
+	// next is the handler without the groups, the attributes of the context are added to it
+	next slog.Handler
+	// grouped are the groups and the attributes following them, applied after the attributes of the context
+	grouped []groupOrAttrs
+	// applied is next with the grouped applied, which handles the records of a context without attributes
+	applied slog.Handler
+}
+
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
+}
+
+func NewHandler(next slog.Handler) *Handler {
+	return &Handler{next: next, applied: next}
+}
+
+func (h *Handler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := slices.Clone(Attrs(ctx))
+	r.Attrs(func(a slog.Attr) bool {
+		if err, ok := a.Value.Any().(error); ok {
+			attrs = appendMissing(attrs, errorAttrs(err))
+		}
+		return true
+	})
+
+	if len(attrs) == 0 {
+		return h.applied.Handle(ctx, r)
+	}
+
+	if len(h.grouped) == 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+		return h.next.Handle(ctx, r)
+	}
+
+	// attributes of the record belong to the last group, so the ones of the context are added before the groups
+	return apply(h.next.WithAttrs(attrs), h.grouped).Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(h.grouped) == 0 {
+		next := h.next.WithAttrs(attrs)
+		return &Handler{next: next, applied: next}
+	}
+
+	return h.with(groupOrAttrs{attrs: attrs})
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+
+	return h.with(groupOrAttrs{group: name})
+}
+
+func (h *Handler) with(g groupOrAttrs) *Handler {
+	return &Handler{next: h.next, grouped: append(slices.Clip(h.grouped), g), applied: apply(h.applied, []groupOrAttrs{g})}
+}
+
+// apply adds the groups and the attributes to the handler in their order
+func apply(next slog.Handler, grouped []groupOrAttrs) slog.Handler {
+	for _, g := range grouped {
+		if len(g.group) != 0 {
+			next = next.WithGroup(g.group)
+		} else {
+			next = next.WithAttrs(g.attrs)
+		}
+	}
+
+	return next
+}
+
+// Err is the attribute of the error, which is logged along with the attributes of the context the error was wrapped with.
+func Err(err error) slog.Attr {
+	return slog.Any("err", err)
+}
+
+type contextError struct {
+	error
+	attrs []slog.Attr
+}
+
+func (e *contextError) Unwrap() error {
+	return e.error
+}
+
+// WrapError annotates the error with the attributes of the context, so they are logged with the error
+// even when it is logged without the context, see Err. The message of the error is not changed.
+func WrapError(ctx context.Context, err error) error {
+	attrs := Attrs(ctx)
+	if err == nil || len(attrs) == 0 {
+		return err
+	}
+
+	var wrapped *contextError
+	if errors.As(err, &wrapped) {
+		return err
+	}
+
+	return &contextError{error: err, attrs: attrs}
+}
+
+func errorAttrs(err error) []slog.Attr {
+	var wrapped *contextError
+	if !errors.As(err, &wrapped) {
+		return nil
+	}
+
+	return wrapped.attrs
+}
+
+// appendMissing appends the attributes with keys, which are not present yet
+func appendMissing(attrs, more []slog.Attr) []slog.Attr {
+	for _, a := range more {
+		if !slices.ContainsFunc(attrs, func(b slog.Attr) bool { return a.Key == b.Key }) {
+			attrs = append(attrs, a)
+		}
+	}
+
+	return attrs
+}
@@ -0,0 +1,77 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"todo/internal/logging"
+)
+
+func Test_Handler(t *testing.T) {
+	ctx := logging.WithAttrs(context.Background(), slog.String("request_id", "42"))
+	failed := logging.WrapError(ctx, errors.New("disk full"))
+
+	for name, tc := range map[string]struct {
+		log      func(l *slog.Logger)
+		expected []string
+	}{
+		"attributes of the context": {
+			log:      func(l *slog.Logger) { l.InfoContext(ctx, "received request") },
+			expected: []string{"msg=\"received request\"", "request_id=42"},
+		},
+		"attributes of the error logged without the context": {
+			log:      func(l *slog.Logger) { l.Error("failed", logging.Err(fmt.Errorf("saving task, %w", failed))) },
+			expected: []string{"err=\"saving task, disk full\"", "request_id=42"},
+		},
+		"attributes are not repeated": {
+			log:      func(l *slog.Logger) { l.ErrorContext(ctx, "failed", logging.Err(failed)) },
+			expected: []string{"err=\"disk full\" request_id=42\n"},
+		},
+		"attributes of the context stay outside of the groups": {
+			log: func(l *slog.Logger) {
+				l.WithGroup("http").With(slog.Int("status", 200)).WithGroup("client").InfoContext(ctx, "served", slog.String("ip", "::1"))
+			},
+			expected: []string{" request_id=42 http.status=200 http.client.ip=::1\n"},
+		},
+		"attributes of the error stay outside of the groups": {
+			log:      func(l *slog.Logger) { l.WithGroup("task").Error("failed", logging.Err(failed)) },
+			expected: []string{" request_id=42 task.err=\"disk full\"\n"},
+		},
+		"groups without attributes of the context": {
+			log:      func(l *slog.Logger) { l.WithGroup("http").Info("served", slog.Int("status", 200)) },
+			expected: []string{" http.status=200\n"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			tc.log(slog.New(logging.NewHandler(slog.NewTextHandler(buf, nil))))
+
+			for _, e := range tc.expected {
+				if !strings.Contains(buf.String(), e) {
+					t.Errorf("expected: %s in record: %s", e, buf)
+				}
+			}
+		})
+	}
+}
+
+func Test_WrapError(t *testing.T) {
+	cause := errors.New("disk full")
+	if err := logging.WrapError(context.Background(), cause); err != cause {
+		t.Errorf("expected the error of a context without attributes to be kept, got: %v", err)
+	}
+
+	ctx := logging.WithAttrs(context.Background(), slog.String("request_id", "42"))
+	err := logging.WrapError(ctx, cause)
+	if !errors.Is(err, cause) || err.Error() != cause.Error() {
+		t.Errorf("expected the error to wrap: %v, got: %v", cause, err)
+	}
+
+	if logging.WrapError(ctx, nil) != nil {
+		t.Error("expected nil error to stay nil")
+	}
+}
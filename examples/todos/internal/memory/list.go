@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"todo/internal/todo"
+)
+
+// compile-time guarantee, that *TaskStorage implements ListStorage interface
+var _ todo.ListStorage = &TaskStorage{}
+
+func (s *TaskStorage) UpsertList(ctx context.Context, l todo.List) (todo.List, error) {
+	if err := ctx.Err(); err != nil {
+		return todo.List{}, fmt.Errorf("upserting list: %s, %w", l.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if found, ok := s.lists[l.ID]; ok && found.OwnerID != l.OwnerID {
+		return todo.List{}, fmt.Errorf("upserting list: %s of: %s, %w", l.ID, l.OwnerID, todo.ErrListNotFound)
+	}
+
+	s.lists[l.ID] = l
+	return l, nil
+}
+
+func (s *TaskStorage) GetList(ctx context.Context, id todo.ListID, owner todo.UserID) (todo.List, error) {
+	if err := ctx.Err(); err != nil {
+		return todo.List{}, fmt.Errorf("getting list by id: %s, %w", id, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	l, ok := s.lists[id]
+	if !ok || l.OwnerID != owner {
+		return todo.List{}, fmt.Errorf("getting list by id: %s, %w", id, todo.ErrListNotFound)
+	}
+
+	return l, nil
+}
+
+func (s *TaskStorage) Lists(ctx context.Context, owner todo.UserID, archived bool) ([]todo.List, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("listing lists, archived: %t, %w", archived, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]todo.List, 0, len(s.lists))
+	for _, l := range s.lists {
+		if l.OwnerID == owner && (archived || !l.Archived) {
+			out = append(out, l)
+		}
+	}
+
+	slices.SortFunc(out, func(a, b todo.List) int {
+		return cmp.Or(cmp.Compare(asciiLower(a.Name), asciiLower(b.Name)), cmp.Compare(a.ID, b.ID))
+	})
+
+	return out, nil
+}
@@ -0,0 +1,318 @@
+// Package memory implements todo.Storage keeping the tasks in a map.
+// The tasks are lost when the process exits, so it is meant for demos and tests.
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"todo/internal/todo"
+)
+
+// compile-time guarantee, that *TaskStorage implements the interfaces of the storages
+var (
+	_ todo.Storage        = &TaskStorage{}
+	_ todo.TaskCounter    = &TaskStorage{}
+	_ todo.HistoryStorage = &TaskStorage{}
+)
+
+// TaskStorage is safe for concurrent use. It behaves exactly like data.SQLiteTaskStorage,
+// including the precision of deadlines, which are stored with seconds precision.
+type TaskStorage struct {
+	mu    sync.RWMutex
+	tasks map[todo.ID]todo.Task
+	lists map[todo.ListID]todo.List
+	// users are keyed by lowered name, because names are unique case-insensitive
+	users    map[string]todo.User
+	sessions map[string]todo.Session
+	tokens   map[todo.TokenID]todo.Token
+	// history of all the tasks in the order of the changes
+	history []ownedChange
+}
+
+// ownedChange keeps the owner of the task, so the history is accessible only to the owner, even after the task is deleted
+type ownedChange struct {
+	owner todo.UserID
+	todo.Change
+}
+
+// NewTaskStorage returns an empty storage, the default lists are created by todo.Handler when they are needed.
+func NewTaskStorage() *TaskStorage {
+	return &TaskStorage{
+		tasks:    make(map[todo.ID]todo.Task),
+		lists:    make(map[todo.ListID]todo.List),
+		users:    make(map[string]todo.User),
+		sessions: make(map[string]todo.Session),
+		tokens:   make(map[todo.TokenID]todo.Token),
+	}
+}
+
+func (s *TaskStorage) Upsert(ctx context.Context, t todo.Task) (stored todo.Task, err error) {
+	if err = ctx.Err(); err != nil {
+		return todo.Task{}, fmt.Errorf("upserting task: %s, %w", t.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found, ok := s.tasks[t.ID]
+	var previous *todo.Task
+	if ok {
+		previous = &found
+	}
+
+	switch {
+	case !ok:
+		t.Version = 1
+	case found.Version != t.Version:
+		return todo.Task{}, fmt.Errorf("upserting task: %s in version: %d, %w", t.ID, t.Version, todo.ErrStaleTask)
+	default:
+		t.Version++
+		// like in SQLite, the owner is set only when the task is created
+		t.OwnerID = found.OwnerID
+	}
+
+	t.Deadline = copyDeadline(t.Deadline)
+	s.tasks[t.ID] = t
+	s.record(ctx, t, todo.ChangesOf(previous, t)...)
+	return withDeadlineCopy(t), nil
+}
+
+func (s *TaskStorage) List(ctx context.Context, f *todo.TaskFilter) ([]todo.Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("listing tasks with filter: %v, %w", f, err)
+	}
+
+	if f == nil {
+		f = &todo.TaskFilter{}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := sortKeys[f.SortBy]
+	if key == nil {
+		key = sortKeys[todo.SortByID]
+	}
+
+	compare := func(a, b todo.Task) int {
+		c := cmp.Or(key(a, b), cmp.Compare(a.ID, b.ID))
+		if f.Descending {
+			return -c
+		}
+		return c
+	}
+
+	var cursor *todo.Task
+	if f.After != nil {
+		found, ok := s.tasks[*f.After]
+		if !ok {
+			return []todo.Task{}, nil
+		}
+		cursor = &found
+	}
+
+	out := make([]todo.Task, 0)
+	for _, t := range s.tasks {
+		if !matches(f, t) {
+			continue
+		}
+
+		if cursor != nil && compare(t, *cursor) <= 0 {
+			continue
+		}
+
+		out = append(out, withDeadlineCopy(t))
+	}
+
+	slices.SortFunc(out, compare)
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+
+	return out, nil
+}
+
+func (s *TaskStorage) Toggle(ctx context.Context, id todo.ID, version int) (todo.Task, error) {
+	if err := ctx.Err(); err != nil {
+		return todo.Task{}, fmt.Errorf("toggling task by id: %s, %w", id, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tasks[id]
+	if !ok {
+		return todo.Task{}, fmt.Errorf("toggling task by id: %s, %w", id, todo.ErrTaskNotFound)
+	}
+
+	if version != 0 && t.Version != version {
+		return todo.Task{}, fmt.Errorf("toggling task: %s in version: %d, %w", id, version, todo.ErrStaleTask)
+	}
+
+	t.Done = !t.Done
+	t.Version++
+	s.tasks[id] = t
+	s.record(ctx, t, todo.ChangeToggled)
+	return withDeadlineCopy(t), nil
+}
+
+func (s *TaskStorage) Delete(ctx context.Context, id todo.ID, version int) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("deleting task by id: %s, %w", id, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tasks[id]
+	if !ok {
+		return fmt.Errorf("deleting task by id: %s, %w", id, todo.ErrTaskNotFound)
+	}
+
+	if version != 0 && t.Version != version {
+		return fmt.Errorf("deleting task: %s in version: %d, %w", id, version, todo.ErrStaleTask)
+	}
+
+	delete(s.tasks, id)
+	s.record(ctx, t, todo.ChangeDeleted)
+	return nil
+}
+
+// record appends the changes of the task to the history, it must be called with the lock held.
+func (s *TaskStorage) record(ctx context.Context, t todo.Task, kinds ...todo.ChangeKind) {
+	now := time.Now()
+	for _, kind := range kinds {
+		c := todo.NewChange(ctx, kind, t, now)
+		c.Deadline = copyDeadline(c.Deadline)
+		s.history = append(s.history, ownedChange{owner: t.OwnerID, Change: c})
+	}
+}
+
+func (s *TaskStorage) History(ctx context.Context, id todo.ID, owner todo.UserID) ([]todo.Change, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("listing history of task: %s, %w", id, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]todo.Change, 0)
+	for _, c := range s.history {
+		if c.TaskID == id && c.owner == owner {
+			c.Deadline = copyDeadline(c.Deadline)
+			out = append(out, c.Change)
+		}
+	}
+
+	return out, nil
+}
+
+func (s *TaskStorage) CountTasks(ctx context.Context) (done, undone int, err error) {
+	if err = ctx.Err(); err != nil {
+		return 0, 0, fmt.Errorf("counting tasks, %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tasks {
+		if t.Done {
+			done++
+		} else {
+			undone++
+		}
+	}
+
+	return done, undone, nil
+}
+
+func matches(f *todo.TaskFilter, t todo.Task) bool {
+	if f.ID != nil && *f.ID != t.ID {
+		return false
+	}
+
+	if f.ListID != nil && *f.ListID != t.ListID {
+		return false
+	}
+
+	if f.OwnerID != nil && *f.OwnerID != t.OwnerID {
+		return false
+	}
+
+	if f.Done != nil && *f.Done != t.Done {
+		return false
+	}
+
+	if f.DeadlineBefore != nil && (t.Deadline == nil || t.Deadline.Unix() >= f.DeadlineBefore.Unix()) {
+		return false
+	}
+
+	if f.DeadlineAfter != nil && (t.Deadline == nil || t.Deadline.Unix() <= f.DeadlineAfter.Unix()) {
+		return false
+	}
+
+	if len(f.TitleContains) != 0 && !containsFold(t.Title, f.TitleContains) {
+		return false
+	}
+
+	return true
+}
+
+// sortKeys compare the tasks the same way as SQL expressions of data.SQLiteTaskStorage
+var sortKeys = map[todo.SortBy]func(a, b todo.Task) int{
+	"":            func(a, b todo.Task) int { return 0 },
+	todo.SortByID: func(a, b todo.Task) int { return 0 },
+	todo.SortByTitle: func(a, b todo.Task) int {
+		return cmp.Compare(asciiLower(a.Title), asciiLower(b.Title))
+	},
+	todo.SortByDeadline: func(a, b todo.Task) int {
+		return cmp.Compare(deadlineKey(a), deadlineKey(b))
+	},
+}
+
+// deadlineKey puts tasks without the deadline last in ascending order
+func deadlineKey(t todo.Task) int64 {
+	if t.Deadline == nil {
+		return 1<<63 - 1
+	}
+
+	return t.Deadline.Unix()
+}
+
+// containsFold is an equivalent of SQL: instr(lower(title), lower(?)) > 0
+func containsFold(s, substr string) bool {
+	return strings.Contains(asciiLower(s), asciiLower(substr))
+}
+
+// asciiLower lowers only ASCII letters, like lower() function of SQLite does
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+
+	return string(b)
+}
+
+// copyDeadline truncates the deadline to seconds, which is the precision of RFC3339 used by SQLite storage
+func copyDeadline(d *time.Time) *time.Time {
+	if d == nil {
+		return nil
+	}
+
+	c := d.Truncate(time.Second)
+	return &c
+}
+
+// withDeadlineCopy makes sure the caller cannot modify the stored deadline through the pointer
+func withDeadlineCopy(t todo.Task) todo.Task {
+	t.Deadline = copyDeadline(t.Deadline)
+	return t
+}
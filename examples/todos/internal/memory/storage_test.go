@@ -0,0 +1,27 @@
+package memory_test
+
+import (
+	"testing"
+	"todo/internal/memory"
+	"todo/internal/todo"
+	"todo/internal/todo/todotest"
+)
+
+// this test should be run with a flag '-race'
+func Test_TaskStorage(t *testing.T) {
+	todotest.ShouldBehaveLikeStorage(t, func(t *testing.T) todo.Storage {
+		return memory.NewTaskStorage()
+	})
+}
+
+func Test_TaskStorage_Lists(t *testing.T) {
+	todotest.ShouldBehaveLikeListStorage(t, func(t *testing.T) todo.ListStorage {
+		return memory.NewTaskStorage()
+	})
+}
+
+func Test_TaskStorage_Users(t *testing.T) {
+	todotest.ShouldBehaveLikeUserStorage(t, func(t *testing.T) todo.UserStorage {
+		return memory.NewTaskStorage()
+	})
+}
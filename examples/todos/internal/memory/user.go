@@ -0,0 +1,188 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+	"todo/internal/todo"
+)
+
+// compile-time guarantee, that *TaskStorage implements UserStorage interface
+var _ todo.UserStorage = &TaskStorage{}
+
+func (s *TaskStorage) CreateUser(ctx context.Context, u todo.User) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("creating user: %s, %w", u.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := asciiLower(u.Name)
+	if _, ok := s.users[key]; ok {
+		return fmt.Errorf("creating user: %s, %w", u.Name, todo.ErrUserExists)
+	}
+
+	u.PasswordHash = slices.Clone(u.PasswordHash)
+	s.users[key] = u
+	return nil
+}
+
+func (s *TaskStorage) UserByName(ctx context.Context, name string) (todo.User, error) {
+	if err := ctx.Err(); err != nil {
+		return todo.User{}, fmt.Errorf("getting user by name: %s, %w", name, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[asciiLower(name)]
+	if !ok {
+		return todo.User{}, fmt.Errorf("getting user by name: %s, %w", name, todo.ErrUserNotFound)
+	}
+
+	u.PasswordHash = slices.Clone(u.PasswordHash)
+	return u, nil
+}
+
+func (s *TaskStorage) CreateSession(ctx context.Context, session todo.Session, now time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("creating session of user: %s, %w", session.UserID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, other := range s.sessions {
+		if other.ExpiresAt.Unix() <= now.Unix() {
+			delete(s.sessions, hash)
+		}
+	}
+
+	s.sessions[session.TokenHash] = session
+	return nil
+}
+
+func (s *TaskStorage) SessionUser(ctx context.Context, tokenHash string, now time.Time) (todo.User, error) {
+	if err := ctx.Err(); err != nil {
+		return todo.User{}, fmt.Errorf("getting user of session, %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[tokenHash]
+	// expiry has seconds precision, like in SQLite
+	if !ok || session.ExpiresAt.Unix() <= now.Unix() {
+		return todo.User{}, fmt.Errorf("getting user of session, %w", todo.ErrSessionNotFound)
+	}
+
+	u, ok := s.userByID(session.UserID)
+	if !ok {
+		return todo.User{}, fmt.Errorf("getting user: %s of session, %w", session.UserID, todo.ErrSessionNotFound)
+	}
+
+	return u, nil
+}
+
+func (s *TaskStorage) DeleteSession(ctx context.Context, tokenHash string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("deleting session, %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, tokenHash)
+	return nil
+}
+
+func (s *TaskStorage) CreateToken(ctx context.Context, t todo.Token) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("creating token: %s of user: %s, %w", t.ID, t.UserID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// creation time is stored with seconds precision, like in SQLite
+	t.CreatedAt = t.CreatedAt.Truncate(time.Second)
+	s.tokens[t.ID] = t
+	return nil
+}
+
+func (s *TaskStorage) Tokens(ctx context.Context, user todo.UserID) ([]todo.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("listing tokens of user: %s, %w", user, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]todo.Token, 0)
+	for _, t := range s.tokens {
+		if t.UserID == user {
+			out = append(out, t)
+		}
+	}
+
+	slices.SortFunc(out, func(a, b todo.Token) int {
+		return cmp.Or(cmp.Compare(a.CreatedAt.Unix(), b.CreatedAt.Unix()), cmp.Compare(a.ID, b.ID))
+	})
+
+	return out, nil
+}
+
+func (s *TaskStorage) TokenByHash(ctx context.Context, hash string) (todo.Token, todo.User, error) {
+	if err := ctx.Err(); err != nil {
+		return todo.Token{}, todo.User{}, fmt.Errorf("getting token by hash, %w", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if t.Hash != hash {
+			continue
+		}
+
+		u, ok := s.userByID(t.UserID)
+		if !ok {
+			break
+		}
+
+		return t, u, nil
+	}
+
+	return todo.Token{}, todo.User{}, fmt.Errorf("getting token by hash, %w", todo.ErrTokenNotFound)
+}
+
+func (s *TaskStorage) DeleteToken(ctx context.Context, user todo.UserID, id todo.TokenID) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("deleting token: %s of user: %s, %w", id, user, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[id]; !ok || t.UserID != user {
+		return fmt.Errorf("deleting token: %s of user: %s, %w", id, user, todo.ErrTokenNotFound)
+	}
+
+	delete(s.tokens, id)
+	return nil
+}
+
+// userByID must be called with the lock held
+func (s *TaskStorage) userByID(id todo.UserID) (todo.User, bool) {
+	for _, u := range s.users {
+		if u.ID == id {
+			u.PasswordHash = slices.Clone(u.PasswordHash)
+			return u, true
+		}
+	}
+
+	return todo.User{}, false
+}
@@ -0,0 +1,300 @@
+// Package metrics keeps counters, histograms and gauges of the process and exposes them in the text format of Prometheus.
+// It implements just the part of the format needed by the server, so no client library is required.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"todo/internal/logging"
+)
+
+// DefaultBuckets are the upper bounds of histogram buckets in seconds, suitable for latencies of requests.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry is safe for concurrent use. Metrics are written in the order they were registered.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+type metric interface {
+	write(ctx context.Context, w io.Writer) error
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// desc describes a metric with the names of its labels.
+type desc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (r *Registry) register(d desc, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// registering the same metric twice is a programming error, like in the Prometheus client
+	if r.names[d.name] {
+		panic("metrics: duplicate metric: " + d.name)
+	}
+
+	r.names[d.name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// series are the values of a metric with the same label values
+type series[T any] struct {
+	mu     sync.Mutex
+	values map[string]*T
+	labels map[string][]string
+}
+
+func newSeries[T any]() series[T] {
+	return series[T]{values: make(map[string]*T), labels: make(map[string][]string)}
+}
+
+// with calls f with the value of the label values, which is created on the first use.
+func (s *series[T]) with(d desc, labelValues []string, create func() *T, f func(*T)) {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got: %d", d.name, len(d.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.values[key]
+	if !ok {
+		v = create()
+		s.values[key] = v
+		s.labels[key] = slices.Clone(labelValues)
+	}
+	f(v)
+}
+
+// each calls f with the values ordered by their label values, so the output is stable.
+func (s *series[T]) each(f func(labelValues []string, v *T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		f(s.labels[k], s.values[k])
+	}
+}
+
+// Counter only goes up, e.g. the number of served requests.
+type Counter struct {
+	desc
+	series series[float64]
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name: name, help: help, typ: "counter", labels: labels}, series: newSeries[float64]()}
+	r.register(c.desc, c)
+	return c
+}
+
+// Inc adds one to the counter of the label values, which must be given in the order of the labels.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds non-negative v to the counter of the label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter can not decrease: " + c.name)
+	}
+
+	c.series.with(c.desc, labelValues, func() *float64 { return new(float64) }, func(f *float64) { *f += v })
+}
+
+func (c *Counter) write(_ context.Context, w io.Writer) error {
+	writeHeader(w, c.desc)
+	c.series.each(func(labelValues []string, v *float64) {
+		writeSample(w, c.name, c.labels, labelValues, *v)
+	})
+	return nil
+}
+
+// Histogram counts observed values, e.g. latencies, in buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+	series  series[histogram]
+}
+
+type histogram struct {
+	// counts are not cumulative, the last one counts the values above all the buckets
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram registers a histogram with the upper bounds of its buckets in increasing order, see DefaultBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !slices.IsSorted(buckets) {
+		panic("metrics: buckets must be sorted: " + name)
+	}
+
+	h := &Histogram{
+		desc:    desc{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: slices.Clone(buckets),
+		series:  newSeries[histogram](),
+	}
+	r.register(h.desc, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	create := func() *histogram { return &histogram{counts: make([]uint64, len(h.buckets)+1)} }
+	h.series.with(h.desc, labelValues, create, func(s *histogram) {
+		i, _ := slices.BinarySearch(h.buckets, v)
+		s.counts[i]++
+		s.sum += v
+		s.count++
+	})
+}
+
+func (h *Histogram) write(_ context.Context, w io.Writer) error {
+	writeHeader(w, h.desc)
+	labels := append(slices.Clip(h.labels), "le")
+	h.series.each(func(labelValues []string, s *histogram) {
+		cumulative := uint64(0)
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, h.name+"_bucket", labels, append(slices.Clip(labelValues), formatFloat(le)), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", labels, append(slices.Clip(labelValues), "+Inf"), float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, labelValues, s.sum)
+		writeSample(w, h.name+"_count", h.labels, labelValues, float64(s.count))
+	})
+	return nil
+}
+
+// Collect is called on every scrape to set the values of a metric, e.g. counted in the storage.
+type Collect func(ctx context.Context, set func(v float64, labelValues ...string)) error
+
+type funcMetric struct {
+	desc
+	collect Collect
+}
+
+// GaugeFunc registers a gauge, which can go up and down, with values collected on every scrape.
+func (r *Registry) GaugeFunc(name, help string, labels []string, collect Collect) {
+	m := &funcMetric{desc: desc{name: name, help: help, typ: "gauge", labels: labels}, collect: collect}
+	r.register(m.desc, m)
+}
+
+// CounterFunc registers a counter with values collected on every scrape, e.g. kept by the runtime.
+func (r *Registry) CounterFunc(name, help string, labels []string, collect Collect) {
+	m := &funcMetric{desc: desc{name: name, help: help, typ: "counter", labels: labels}, collect: collect}
+	r.register(m.desc, m)
+}
+
+func (m *funcMetric) write(ctx context.Context, w io.Writer) error {
+	buf := &bytes.Buffer{}
+	writeHeader(buf, m.desc)
+	err := m.collect(ctx, func(v float64, labelValues ...string) {
+		if len(labelValues) != len(m.labels) {
+			panic(fmt.Sprintf("metrics: %s expects %d label values, got: %d", m.name, len(m.labels), len(labelValues)))
+		}
+		writeSample(buf, m.name, m.labels, labelValues, v)
+	})
+	if err != nil {
+		return fmt.Errorf("collecting metric: %s, %w", m.name, err)
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// WriteTo writes all the metrics in the text format. Metrics, which fail to be collected, are left out,
+// so a single failing metric does not hide all the others. The error of the last failed one is returned.
+func (r *Registry) WriteTo(ctx context.Context, w io.Writer) error {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	var last error
+	for _, m := range metrics {
+		if err := m.write(ctx, w); err != nil {
+			last = err
+		}
+	}
+
+	return last
+}
+
+// Handler serves the metrics to be scraped by Prometheus.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		buf := &bytes.Buffer{}
+		err := r.WriteTo(req.Context(), buf)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "collecting the metrics", logging.Err(err))
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = buf.WriteTo(w)
+	})
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func writeHeader(w io.Writer, d desc) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, helpEscaper.Replace(d.help), d.name, d.typ)
+}
+
+func writeSample(w io.Writer, name string, labels, labelValues []string, v float64) {
+	b := strings.Builder{}
+	b.WriteString(name)
+	if len(labels) != 0 {
+		b.WriteByte('{')
+		for i, l := range labels {
+			if i != 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(l + `="` + labelEscaper.Replace(labelValues[i]) + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + formatFloat(v) + "\n")
+	_, _ = io.WriteString(w, b.String())
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,75 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"todo/internal/metrics"
+)
+
+func Test_Registry(t *testing.T) {
+	r := metrics.NewRegistry()
+	requests := r.Counter("requests_total", "Number of requests.", "route", "status")
+	requests.Inc("GET /", "200")
+	requests.Inc("GET /", "200")
+	requests.Add(3, `say "hi"`, "404")
+
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.1, "GET /")
+	latency.Observe(0.5, "GET /")
+	latency.Observe(2, "GET /")
+
+	r.GaugeFunc("tasks", "Number of tasks.", []string{"done"}, func(_ context.Context, set func(v float64, labelValues ...string)) error {
+		set(1, "true")
+		set(2, "false")
+		return nil
+	})
+	r.GaugeFunc("broken", "Fails to be collected.", nil, func(_ context.Context, set func(v float64, labelValues ...string)) error {
+		set(1)
+		return errors.New("database is gone")
+	})
+
+	buf := &bytes.Buffer{}
+	err := r.WriteTo(context.Background(), buf)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("expected the error of the broken metric, got: %v", err)
+	}
+
+	expected := `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{route="GET /",status="200"} 2
+requests_total{route="say \"hi\"",status="404"} 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="GET /",le="0.1"} 1
+latency_seconds_bucket{route="GET /",le="1"} 2
+latency_seconds_bucket{route="GET /",le="+Inf"} 3
+latency_seconds_sum{route="GET /"} 2.6
+latency_seconds_count{route="GET /"} 3
+# HELP tasks Number of tasks.
+# TYPE tasks gauge
+tasks{done="true"} 1
+tasks{done="false"} 2
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf)
+	}
+}
+
+func Test_RegisterRuntime(t *testing.T) {
+	r := metrics.NewRegistry()
+	metrics.RegisterRuntime(r)
+
+	buf := &bytes.Buffer{}
+	if err := r.WriteTo(context.Background(), buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"\ngo_goroutines ", "\ngo_gc_cycles_total ", "# TYPE go_gc_cycles_total counter", "go_info{version=\"go"} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("expected: %q in:\n%s", expected, buf)
+		}
+	}
+}
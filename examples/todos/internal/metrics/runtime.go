@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"context"
+	"runtime"
+	"runtime/metrics"
+)
+
+// runtimeMetric maps a metric of the Go runtime, see runtime/metrics, to the name of the exposed one.
+type runtimeMetric struct {
+	name    string
+	help    string
+	counter bool
+	sample  string
+}
+
+var runtimeMetrics = []runtimeMetric{
+	{name: "go_goroutines", help: "Number of goroutines that currently exist.", sample: "/sched/goroutines:goroutines"},
+	{name: "go_memory_total_bytes", help: "All memory mapped by the Go runtime.", sample: "/memory/classes/total:bytes"},
+	{name: "go_heap_objects_bytes", help: "Memory occupied by live and not yet swept objects on the heap.", sample: "/memory/classes/heap/objects:bytes"},
+	{name: "go_heap_objects", help: "Number of objects, live or unswept, occupying heap memory.", sample: "/gc/heap/objects:objects"},
+	{name: "go_gc_cycles_total", help: "Number of completed GC cycles.", counter: true, sample: "/gc/cycles/total:gc-cycles"},
+}
+
+// RegisterRuntime registers the stats of the Go runtime, which are read on every scrape without stopping the world.
+func RegisterRuntime(r *Registry) {
+	for _, m := range runtimeMetrics {
+		sample := m.sample
+		collect := func(_ context.Context, set func(v float64, labelValues ...string)) error {
+			s := []metrics.Sample{{Name: sample}}
+			metrics.Read(s)
+			switch s[0].Value.Kind() {
+			case metrics.KindUint64:
+				set(float64(s[0].Value.Uint64()))
+			case metrics.KindFloat64:
+				set(s[0].Value.Float64())
+			default:
+				// the metric is not supported by the runtime, its value is left out
+			}
+			return nil
+		}
+
+		if m.counter {
+			r.CounterFunc(m.name, m.help, nil, collect)
+		} else {
+			r.GaugeFunc(m.name, m.help, nil, collect)
+		}
+	}
+
+	r.GaugeFunc("go_info", "Version of Go the binary was built with.", []string{"version"}, func(_ context.Context, set func(v float64, labelValues ...string)) error {
+		set(1, runtime.Version())
+		return nil
+	})
+}
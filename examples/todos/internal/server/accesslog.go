@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"todo/internal/logging"
+	"todo/internal/metrics"
+)
+
+type ridKey string
+
+const RequestID = ridKey("request-id")
+
+// requestIDHeader is honoured when the request comes with one, e.g. from a proxy, and is always set in the response.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits the id taken from the request, so a client can not flood the logs.
+const maxRequestIDLength = 128
+
+// requestMetrics count the requests and measure their latency per route and status.
+type requestMetrics struct {
+	requests *metrics.Counter
+	latency  *metrics.Histogram
+}
+
+func newRequestMetrics(r *metrics.Registry) *requestMetrics {
+	return &requestMetrics{
+		requests: r.Counter("http_requests_total", "Number of served HTTP requests.", "route", "status"),
+		latency:  r.Histogram("http_request_duration_seconds", "Latency of served HTTP requests.", metrics.DefaultBuckets, "route", "status"),
+	}
+}
+
+// observe records the request. Unmatched requests have an empty route, the path is never used as a label,
+// because a client could create an unlimited number of series with it.
+func (m *requestMetrics) observe(route string, status int, latency time.Duration) {
+	code := strconv.Itoa(status)
+	m.requests.Inc(route, code)
+	m.latency.Observe(latency.Seconds(), route, code)
+}
+
+// logRequest logs the start and the end of the request, the latter with the status, the size and the route.
+// The id of the request is logged with every record and error of the request, see logging.WithAttrs.
+func logRequest(m *requestMetrics, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rid := r.Header.Get(requestIDHeader)
+		if !validRequestID(rid) {
+			rid = strconv.FormatInt(rand.Int63(), 10)
+		}
+
+		w.Header().Set(requestIDHeader, rid)
+		ctx := context.WithValue(r.Context(), RequestID, rid)
+		ctx = logging.WithAttrs(ctx, slog.String("request_id", rid))
+		route := ""
+		ctx = context.WithValue(ctx, routeKey{}, &route)
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			latency := time.Since(start)
+			m.observe(route, sw.Status(), latency)
+			slog.InfoContext(ctx, "finished request",
+				slog.String("method", r.Method),
+				slog.String("url", r.URL.String()),
+				slog.String("route", route),
+				slog.Int("status", sw.Status()),
+				slog.Int64("bytes", sw.bytes),
+				slog.String("remote", r.RemoteAddr),
+				slog.String("user_agent", r.UserAgent()),
+				slog.Duration("latency", latency),
+			)
+		}()
+		slog.InfoContext(ctx, "received request", slog.String("method", r.Method), slog.String("url", r.URL.String()))
+		h.ServeHTTP(sw, r.WithContext(ctx))
+	})
+}
+
+// validRequestID accepts ids of printable ASCII characters, which are safe to log and echo in the response.
+func validRequestID(rid string) bool {
+	if len(rid) == 0 || len(rid) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(rid); i++ {
+		if rid[i] < 0x21 || rid[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// statusWriter captures the status and the size of the response for the access log.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Status is 200 OK if the handler wrote nothing at all, like the server does.
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the features of the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type routeKey struct{}
+
+// routed records the pattern matched by the mux for the access log, e.g. "GET /api/todos/{id}".
+// Muxes nested under a prefix pass it, so the innermost mux records the full pattern of the route.
+func routed(prefix string, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+			if _, pattern := mux.Handler(r); len(pattern) != 0 {
+				*route = withPrefix(prefix, pattern)
+			}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func withPrefix(prefix, pattern string) string {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		return prefix + pattern
+	}
+	return method + " " + prefix + path
+}
@@ -0,0 +1,363 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"todo/internal/logging"
+	"todo/internal/todo"
+)
+
+const (
+	apiPrefix = "/api"
+	mimeJSON  = "application/json"
+	mimeHTML  = "text/html"
+)
+
+// createTaskRequest is a JSON body of POST /api/todos
+type createTaskRequest struct {
+	Title    string      `json:"title"`
+	Deadline *time.Time  `json:"deadline"`
+	ListID   todo.ListID `json:"list_id"`
+}
+
+// patchTaskRequest is a JSON body of PATCH /api/todos/{id}.
+// Fields which are not present in the body are left untouched.
+// Deadline is kept raw, so explicit null (which removes the deadline) can be told apart from a missing field.
+type patchTaskRequest struct {
+	Title    *string         `json:"title"`
+	Deadline json.RawMessage `json:"deadline"`
+	Done     *bool           `json:"done"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+	// Code tells apart the reasons of authentication errors, see authErr
+	Code string `json:"code,omitempty"`
+}
+
+// HandleGetTodos lists the tasks matching the query parameters, see filterFromQuery.
+// When the page is full, the next one is linked in the Link header.
+func (h *Http) HandleGetTodos(w http.ResponseWriter, r *http.Request) {
+	f, err := filterFromQuery(r.URL.Query())
+	if err != nil {
+		slog.InfoContext(r.Context(), "parsing the filter", logging.Err(err))
+		jsonErr(w, http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := h.h.List(r.Context(), f)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing the tasks", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	if next, ok := nextPage(r.URL, f, tasks); ok {
+		w.Header().Set("Link", "<"+next+`>; rel="next"`)
+	}
+
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+func (h *Http) HandleGetTodo(w http.ResponseWriter, r *http.Request) {
+	task, err := h.h.Get(r.Context(), todo.ID(r.PathValue("id")))
+	if errors.Is(err, todo.ErrTaskNotFound) {
+		jsonErr(w, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting the task", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag(task))
+	if matchesETag(r.Header.Get("If-None-Match"), task) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, task)
+}
+
+// handlePostTodoJSON creates a task from the JSON body and responds with the stored task.
+func (h *Http) handlePostTodoJSON(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := createTaskRequest{}
+	err := decodeJSON(r, &req)
+	if err != nil {
+		slog.InfoContext(ctx, "decoding the task", logging.Err(err))
+		jsonErr(w, readErr(err))
+		return
+	}
+
+	stored, err := h.h.Create(ctx, todo.CreateTask{Title: req.Title, Deadline: req.Deadline, ListID: req.ListID})
+	if errors.Is(err, todo.ErrInvalidTask) {
+		slog.InfoContext(ctx, "invalid task", logging.Err(err))
+		jsonErr(w, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "creating the task", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", taskLocation(stored.ID))
+	w.Header().Set("ETag", etag(stored))
+	writeJSON(w, http.StatusCreated, stored)
+}
+
+// HandlePatchTodo responds with the patched task, the index page asks for its fragment with Accept: text/html, see wantsFragment.
+func (h *Http) HandlePatchTodo(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := patchTaskRequest{}
+	err := decodeJSON(r, &req)
+	if err != nil {
+		slog.InfoContext(ctx, "decoding the patch", logging.Err(err))
+		jsonErr(w, readErr(err))
+		return
+	}
+
+	stored, err := h.patchTask(ctx, todo.ID(r.PathValue("id")), req, r.Header.Get("If-Match"))
+	if errors.Is(err, errInvalidPatch) || errors.Is(err, todo.ErrInvalidTask) {
+		slog.InfoContext(ctx, "invalid patch", logging.Err(err))
+		jsonErr(w, http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, todo.ErrTaskNotFound) {
+		jsonErr(w, http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, todo.ErrStaleTask) {
+		jsonErr(w, http.StatusPreconditionFailed)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "updating the task", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	if wantsFragment(r) {
+		h.renderItem(w, r, http.StatusOK, stored)
+		return
+	}
+
+	w.Header().Set("ETag", etag(stored))
+	writeJSON(w, http.StatusOK, stored)
+}
+
+// HandleDeleteTodo responds with 204 No Content, so it works for both JSON clients and the UI.
+// With If-Match the task is deleted only if it was not modified since the client read it.
+func (h *Http) HandleDeleteTodo(w http.ResponseWriter, r *http.Request) {
+	id := todo.ID(r.PathValue("id"))
+	version, status := h.ifMatch(r, id)
+	if status != 0 {
+		jsonErr(w, status)
+		return
+	}
+
+	err := h.h.Delete(r.Context(), id, version)
+	if errors.Is(err, todo.ErrTaskNotFound) {
+		jsonErr(w, http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, todo.ErrStaleTask) {
+		jsonErr(w, http.StatusPreconditionFailed)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "deleting the task", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var errInvalidPatch = errors.New("invalid patch")
+
+// patchTask applies the patch to the current state of the task.
+// With If-Match the task is updated only in the version the client read, otherwise ErrStaleTask is returned.
+// Without it the patch is applied again to the version stored by a concurrent write, as the client asked for no precondition.
+func (h *Http) patchTask(ctx context.Context, id todo.ID, req patchTaskRequest, ifMatch string) (todo.Task, error) {
+	for {
+		task, err := h.h.Get(ctx, id)
+		if err != nil {
+			return todo.Task{}, fmt.Errorf("getting the task to patch, %w", err)
+		}
+
+		if len(ifMatch) != 0 && !matchesETag(ifMatch, task) {
+			return todo.Task{}, fmt.Errorf("matching: %s with the task: %s, %w", ifMatch, id, todo.ErrStaleTask)
+		}
+
+		cmd, err := req.toCommand(task)
+		if err != nil {
+			return todo.Task{}, fmt.Errorf("applying the patch, %w: %w", errInvalidPatch, err)
+		}
+
+		stored, err := h.h.Update(ctx, cmd)
+		if errors.Is(err, todo.ErrStaleTask) && len(ifMatch) == 0 {
+			continue
+		}
+
+		return stored, err
+	}
+}
+
+// toCommand merges the patch with the current state of the task.
+func (p patchTaskRequest) toCommand(current todo.Task) (todo.UpdateTask, error) {
+	cmd := todo.UpdateTask{
+		ID:       current.ID,
+		Title:    current.Title,
+		Deadline: current.Deadline,
+		Done:     p.Done,
+		Version:  current.Version,
+	}
+
+	if p.Title != nil {
+		cmd.Title = *p.Title
+	}
+
+	if p.Deadline == nil {
+		return cmd, nil
+	}
+
+	if bytes.Equal(p.Deadline, []byte("null")) {
+		cmd.Deadline = nil
+		return cmd, nil
+	}
+
+	d := time.Time{}
+	err := json.Unmarshal(p.Deadline, &d)
+	if err != nil {
+		return todo.UpdateTask{}, fmt.Errorf("parsing the deadline: %s, %w", p.Deadline, err)
+	}
+
+	cmd.Deadline = &d
+	return cmd, nil
+}
+
+// ifMatch returns the version of the task required by the If-Match header, zero without the header.
+// The storage rejects the write if the task changes after the check, see todo.ErrStaleTask.
+// Non-zero status is the status of the response, when the task can not be got or the header does not match it.
+func (h *Http) ifMatch(r *http.Request, id todo.ID) (version int, status int) {
+	im := r.Header.Get("If-Match")
+	if len(im) == 0 {
+		return 0, 0
+	}
+
+	task, err := h.h.Get(r.Context(), id)
+	if errors.Is(err, todo.ErrTaskNotFound) {
+		return 0, http.StatusNotFound
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting the task to match", logging.Err(err))
+		return 0, http.StatusInternalServerError
+	}
+
+	if !matchesETag(im, task) {
+		return 0, http.StatusPreconditionFailed
+	}
+
+	return task.Version, 0
+}
+
+// etag of the task changes on every write, because the version is incremented
+func etag(t todo.Task) string {
+	return `"` + strconv.Itoa(t.Version) + `"`
+}
+
+// matchesETag reports whether the value of If-Match or If-None-Match header matches the current version of the task.
+// Weak tags never match, because versions are compared strongly.
+func matchesETag(header string, t todo.Task) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	current := etag(t)
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+
+	return false
+}
+
+func taskLocation(id todo.ID) string {
+	return apiPrefix + "/todos/" + string(id)
+}
+
+// hasJSONBody reports whether the request body is declared as JSON.
+func hasJSONBody(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == mimeJSON
+}
+
+// acceptsJSON reports whether the client prefers JSON over HTML in the response.
+// When the Accept header is missing, the response mirrors the type of the request body.
+func acceptsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if len(accept) == 0 {
+		return hasJSONBody(r)
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		switch mt {
+		case mimeJSON:
+			return true
+		case mimeHTML:
+			return false
+		}
+	}
+
+	return hasJSONBody(r)
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("decoding JSON body, %w", err)
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", mimeJSON)
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		slog.Error("encoding the response", logging.Err(err))
+	}
+}
+
+func jsonErr(w http.ResponseWriter, status int) {
+	writeJSON(w, status, errorResponse{Error: http.StatusText(status)})
+}
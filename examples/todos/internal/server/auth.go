@@ -0,0 +1,184 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"todo/internal/logging"
+	"todo/internal/todo"
+)
+
+const sessionCookie = "session"
+
+// LoginModel is rendered by both the login and the signup page.
+type LoginModel struct {
+	Title string
+	// Action is the path the form is posted to
+	Action string
+	// Name is kept in the form after a failed attempt
+	Name  string
+	Error string
+	// Signup switches the links between the pages
+	Signup bool
+	// CanSignup is false when the registration is disabled
+	CanSignup bool
+	CSRF      string
+}
+
+var (
+	loginPage  = LoginModel{Title: "Log in", Action: "/login"}
+	signupPage = LoginModel{Title: "Sign up", Action: "/signup", Signup: true}
+)
+
+func (h *Http) HandleGetLogin(w http.ResponseWriter, r *http.Request) {
+	h.renderLogin(w, r, http.StatusOK, loginPage)
+}
+
+func (h *Http) HandleGetSignup(w http.ResponseWriter, r *http.Request) {
+	h.renderLogin(w, r, http.StatusOK, signupPage)
+}
+
+func (h *Http) HandlePostLogin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := r.ParseForm()
+	if err != nil {
+		slog.ErrorContext(ctx, "parsing the form", logging.Err(err))
+		httpErr(w, readErr(err))
+		return
+	}
+
+	page := loginPage
+	page.Name = r.PostForm.Get("name")
+	token, _, err := h.h.Login(ctx, page.Name, r.PostForm.Get("password"))
+	if errors.Is(err, todo.ErrInvalidCredentials) {
+		slog.InfoContext(ctx, "invalid credentials", logging.Err(err))
+		page.Error = "Invalid name or password."
+		h.renderLogin(w, r, http.StatusUnauthorized, page)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "logging in", logging.Err(err))
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	setSession(w, r, token)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// HandlePostSignup registers the user and logs them in.
+func (h *Http) HandlePostSignup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := r.ParseForm()
+	if err != nil {
+		slog.ErrorContext(ctx, "parsing the form", logging.Err(err))
+		httpErr(w, readErr(err))
+		return
+	}
+
+	page := signupPage
+	page.Name = r.PostForm.Get("name")
+	password := r.PostForm.Get("password")
+	_, err = h.h.Register(ctx, todo.Register{Name: page.Name, Password: password})
+	if errors.Is(err, todo.ErrInvalidUser) {
+		slog.InfoContext(ctx, "invalid user", logging.Err(err))
+		page.Error = "Name must not be blank and password must have at least 8 characters."
+		h.renderLogin(w, r, http.StatusBadRequest, page)
+		return
+	}
+
+	if errors.Is(err, todo.ErrUserExists) {
+		slog.InfoContext(ctx, "user exists", logging.Err(err))
+		page.Error = "The name is already taken."
+		h.renderLogin(w, r, http.StatusConflict, page)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "registering the user", logging.Err(err))
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	token, _, err := h.h.Login(ctx, page.Name, password)
+	if err != nil {
+		slog.ErrorContext(ctx, "logging in after signup", logging.Err(err))
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	setSession(w, r, token)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (h *Http) HandlePostLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		err = h.h.Logout(r.Context(), c.Value)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "logging out", logging.Err(err))
+			httpErr(w, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (h *Http) renderLogin(w http.ResponseWriter, r *http.Request, status int, page LoginModel) {
+	page.CSRF = csrfToken(r.Context())
+	page.CanSignup = h.signup
+	err := h.ui.RenderStatus(w, status, LoginUI, page)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rendering the login", logging.Err(err))
+	}
+}
+
+func setSession(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(todo.SessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// authenticate passes the request to next handler with the user of the session in the context, see todo.WithUser.
+// Requests without a valid session are passed to unauthenticated handler instead.
+func (h *Http) authenticate(next http.Handler, unauthenticated http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie(sessionCookie)
+		if err != nil {
+			unauthenticated(w, r)
+			return
+		}
+
+		u, err := h.h.Authenticate(r.Context(), c.Value)
+		if errors.Is(err, todo.ErrSessionNotFound) {
+			unauthenticated(w, r)
+			return
+		}
+
+		if err != nil {
+			slog.ErrorContext(r.Context(), "authenticating the session", logging.Err(err))
+			httpErr(w, http.StatusInternalServerError)
+			return
+		}
+
+		ctx := logging.WithAttrs(todo.WithUser(r.Context(), u), slog.String("user_id", string(u.ID)))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// unauthorized responds to API requests without a session or a token
+func unauthorized(w http.ResponseWriter, _ *http.Request) {
+	authErr(w, http.StatusUnauthorized, "")
+}
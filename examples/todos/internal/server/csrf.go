@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"mime"
+	"net/http"
+	"todo/internal/logging"
+)
+
+const (
+	csrfCookie = "csrf"
+	// csrfField is the name of the hidden input of the forms
+	csrfField = "csrf"
+	// csrfHeader is sent by the scripts of the pages along with XHR requests
+	csrfHeader = "X-CSRF-Token"
+)
+
+type csrfKey struct{}
+
+// csrf protects the forms and XHR requests with a double-submit cookie.
+// A random token is kept in the cookie and rendered in the pages, see csrfToken.
+// Requests changing the state must send it back in the form or the header, which a cross-site page can not do,
+// because it can neither read the cookie nor the pages.
+// Requests with Authorization header are exempt, because browsers never add the header on their own.
+func csrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if c, err := r.Cookie(csrfCookie); err == nil && len(c.Value) != 0 {
+			token = c.Value
+		}
+
+		if !isSafe(r.Method) && len(r.Header.Get("Authorization")) == 0 {
+			submitted, err := submittedCSRF(r)
+			if err != nil {
+				slog.InfoContext(r.Context(), "parsing the form", logging.Err(err))
+				httpErr(w, readErr(err))
+				return
+			}
+
+			if len(token) == 0 || !sameToken(token, submitted) {
+				slog.InfoContext(r.Context(), "missing or invalid CSRF token", slog.String("method", r.Method), slog.String("url", r.URL.String()))
+				if acceptsJSON(r) {
+					jsonErr(w, http.StatusForbidden)
+				} else {
+					httpErr(w, http.StatusForbidden)
+				}
+				return
+			}
+		}
+
+		if len(token) == 0 {
+			var err error
+			token, err = newCSRFToken()
+			if err != nil {
+				slog.ErrorContext(r.Context(), "generating CSRF token", logging.Err(err))
+				httpErr(w, http.StatusInternalServerError)
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfKey{}, token)))
+	})
+}
+
+// csrfToken returns the token, which must be rendered in the forms and pages of the request.
+func csrfToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfKey{}).(string)
+	return token
+}
+
+func isSafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// submittedCSRF returns the token from the header or, for submitted forms, from the hidden input.
+// It fails if the form can not be parsed, e.g. it is too large.
+func submittedCSRF(r *http.Request) (string, error) {
+	if v := r.Header.Get(csrfHeader); len(v) != 0 {
+		return v, nil
+	}
+
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mt != "application/x-www-form-urlencoded" {
+		return "", nil
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		return "", err
+	}
+
+	return r.PostForm.Get(csrfField), nil
+}
+
+func sameToken(expected, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// layouts of the value sent by <input type="datetime-local">, seconds are present only when the step is set
+var deadlineLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// parseDeadline parses the value of datetime-local input in the user's time zone.
+// Empty value means there is no deadline. Empty time zone means UTC.
+func parseDeadline(value, tz string) (*time.Time, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	loc := time.UTC
+	if len(tz) != 0 {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("loading time zone: %s, %w", tz, err)
+		}
+		loc = l
+	}
+
+	var err error
+	for _, layout := range deadlineLayouts {
+		var d time.Time
+		d, err = time.ParseInLocation(layout, value, loc)
+		if err == nil {
+			return &d, nil
+		}
+	}
+
+	return nil, fmt.Errorf("parsing deadline: %s, %w", value, err)
+}
+
+// relativeDue describes the deadline relative to now, e.g. "due in 3 hours" or "overdue by 2 days".
+func relativeDue(deadline, now time.Time) string {
+	diff := deadline.Sub(now)
+	if diff < 0 {
+		return "overdue by " + approximate(-diff)
+	}
+
+	if diff < time.Minute {
+		return "due now"
+	}
+
+	return "due in " + approximate(diff)
+}
+
+// approximate rounds the duration down to the biggest unit which fits in it
+func approximate(d time.Duration) string {
+	const day = 24 * time.Hour
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{size: 7 * day, name: "week"},
+		{size: day, name: "day"},
+		{size: time.Hour, name: "hour"},
+		{size: time.Minute, name: "minute"},
+	}
+
+	for _, u := range units {
+		if n := int(d / u.size); n > 0 {
+			return plural(n, u.name)
+		}
+	}
+
+	return "less than a minute"
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+
+	return strconv.Itoa(n) + " " + unit + "s"
+}
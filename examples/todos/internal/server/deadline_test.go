@@ -0,0 +1,76 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseDeadline(t *testing.T) {
+	tt := map[string]struct {
+		value, tz string
+		expected  string
+	}{
+		"no time zone means UTC": {
+			value:    "2024-03-20T18:00",
+			expected: "2024-03-20T18:00:00Z",
+		},
+		"winter time in Warsaw": {
+			value:    "2024-03-20T18:00",
+			tz:       "Europe/Warsaw",
+			expected: "2024-03-20T18:00:00+01:00",
+		},
+		"with seconds": {
+			value:    "2024-07-01T09:30:15",
+			tz:       "America/New_York",
+			expected: "2024-07-01T09:30:15-04:00",
+		},
+	}
+
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			d, err := parseDeadline(tc.value, tc.tz)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := d.Format(time.RFC3339); got != tc.expected {
+				t.Errorf("expected: %s, got: %s", tc.expected, got)
+			}
+		})
+	}
+
+	t.Run("empty value means no deadline", func(t *testing.T) {
+		if d, err := parseDeadline("", "Europe/Warsaw"); d != nil || err != nil {
+			t.Errorf("expected no deadline and no error, got: %v, %v", d, err)
+		}
+	})
+
+	t.Run("unknown time zone is rejected", func(t *testing.T) {
+		if _, err := parseDeadline("2024-03-20T18:00", "Middle/Earth"); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+func Test_relativeDue(t *testing.T) {
+	now := time.Date(2024, 3, 20, 18, 0, 0, 0, time.UTC)
+	tt := map[string]struct {
+		deadline time.Time
+		expected string
+	}{
+		"in a few seconds": {deadline: now.Add(30 * time.Second), expected: "due now"},
+		"in one minute":    {deadline: now.Add(time.Minute), expected: "due in 1 minute"},
+		"in hours":         {deadline: now.Add(3*time.Hour + 59*time.Minute), expected: "due in 3 hours"},
+		"in weeks":         {deadline: now.Add(15 * 24 * time.Hour), expected: "due in 2 weeks"},
+		"a moment ago":     {deadline: now.Add(-time.Second), expected: "overdue by less than a minute"},
+		"days ago":         {deadline: now.Add(-49 * time.Hour), expected: "overdue by 2 days"},
+	}
+
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			if got := relativeDue(tc.deadline, now); got != tc.expected {
+				t.Errorf("expected: %q, got: %q", tc.expected, got)
+			}
+		})
+	}
+}
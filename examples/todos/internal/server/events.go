@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"todo/internal/logging"
+	"todo/internal/todo"
+)
+
+// HandleGetEvents streams the changes of the tasks of the user as Server-Sent Events with JSON data, see todo.Event.
+// A client reconnecting with the Last-Event-ID header gets the events it missed, or a reload event
+// when they are not retained anymore, so it must list the tasks again.
+func (h *Http) HandleGetEvents(w http.ResponseWriter, r *http.Request) {
+	h.streamEvents(w, r, func(e todo.Event) (string, error) {
+		b, err := json.Marshal(e)
+		return string(b), err
+	})
+}
+
+// itemFragment is the data of the events streamed to the index page, the rendered task or the id of the deleted one.
+func (h *Http) itemFragment(e todo.Event) (string, error) {
+	if e.Kind == todo.TaskDeleted {
+		return string(e.Task.ID), nil
+	}
+
+	var b strings.Builder
+	err := h.ui.tpl.ExecuteTemplate(&b, ItemUI, newItemModel(e.Task, h.now()))
+	return strings.TrimSpace(b.String()), err
+}
+
+// streamEvents writes the events until the client disconnects, falls behind or the server shuts down.
+// Idle stream sends a comment every HttpCfg.Heartbeat, so the proxies keep it open and a dead client is noticed.
+func (h *Http) streamEvents(w http.ResponseWriter, r *http.Request, data func(e todo.Event) (string, error)) {
+	after, err := lastEventID(r)
+	if err != nil {
+		slog.InfoContext(r.Context(), "parsing the last event id", logging.Err(err))
+		httpErr(w, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(h.streams, cancel)
+	defer stop()
+
+	sub := h.h.Subscribe(ctx, after)
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// tells nginx not to buffer the stream
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(text string) error {
+		// the stream outlives HttpCfg.WriteTimeout, so only a single write is limited by it
+		err := rc.SetWriteDeadline(time.Now().Add(h.writeTimeout))
+		if err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return fmt.Errorf("extending the write deadline, %w", err)
+		}
+
+		_, err = w.Write([]byte(text))
+		if err != nil {
+			return fmt.Errorf("writing the event, %w", err)
+		}
+
+		return rc.Flush()
+	}
+
+	// the id moves the client past the events it can not get anymore
+	first := ": connected\n\n"
+	if sub.Missed {
+		first = formatEvent(sub.LastID, "reload", "events were missed")
+	}
+
+	err = send(first)
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for err == nil {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			err = send(": heartbeat\n\n")
+		case e, ok := <-sub.Events:
+			if !ok {
+				// the client fell behind, it catches up after reconnecting with the id of the last received event
+				return
+			}
+
+			d, derr := data(e)
+			if derr != nil {
+				slog.ErrorContext(ctx, "rendering the event", slog.Uint64("event_id", e.ID), logging.Err(derr))
+				return
+			}
+			err = send(formatEvent(e.ID, string(e.Kind), d))
+		}
+	}
+
+	slog.InfoContext(ctx, "streaming the events", logging.Err(err))
+}
+
+// formatEvent returns the event in the format of Server-Sent Events, every line of the data is a separate field.
+func formatEvent(id uint64, event, data string) string {
+	var b strings.Builder
+	b.WriteString("id: " + strconv.FormatUint(id, 10) + "\n")
+	b.WriteString("event: " + event + "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// lastEventID is the id of the last event received by the client before it reconnected, zero for a new client.
+func lastEventID(r *http.Request) (uint64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if len(v) == 0 {
+		return 0, nil
+	}
+
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing Last-Event-ID: %q, %w", v, err)
+	}
+
+	return id, nil
+}
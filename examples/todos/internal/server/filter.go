@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"todo/internal/todo"
+)
+
+// filterFromQuery builds the filter from query parameters of the list endpoint:
+//
+//	list=list id, done=true|false, deadline_before=RFC3339, deadline_after=RFC3339, q=title substring,
+//	sort=id|title|deadline (prefixed with '-' for descending order), limit=number, after=cursor
+func filterFromQuery(q url.Values) (*todo.TaskFilter, error) {
+	f := &todo.TaskFilter{}
+
+	if v := q.Get("list"); len(v) != 0 {
+		list := todo.ListID(v)
+		f.ListID = &list
+	}
+
+	if v := q.Get("done"); len(v) != 0 {
+		done, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing done: %s, %w", v, err)
+		}
+		f.Done = &done
+	}
+
+	var err error
+	f.DeadlineBefore, err = parseTimeParam(q, "deadline_before")
+	if err != nil {
+		return nil, err
+	}
+
+	f.DeadlineAfter, err = parseTimeParam(q, "deadline_after")
+	if err != nil {
+		return nil, err
+	}
+
+	f.TitleContains = q.Get("q")
+
+	if v := q.Get("sort"); len(v) != 0 {
+		f.Descending = strings.HasPrefix(v, "-")
+		f.SortBy = todo.SortBy(strings.TrimPrefix(v, "-"))
+		switch f.SortBy {
+		case todo.SortByID, todo.SortByTitle, todo.SortByDeadline:
+		default:
+			return nil, fmt.Errorf("unsupported sort: %s", v)
+		}
+	}
+
+	if v := q.Get("limit"); len(v) != 0 {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("limit must be a positive number, got: %s", v)
+		}
+		f.Limit = limit
+	}
+
+	if v := q.Get("after"); len(v) != 0 {
+		after := todo.ID(v)
+		f.After = &after
+	}
+
+	return f, nil
+}
+
+func parseTimeParam(q url.Values, name string) (*time.Time, error) {
+	v := q.Get(name)
+	if len(v) == 0 {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %s, %w", name, v, err)
+	}
+
+	return &t, nil
+}
+
+// nextPage returns URL of the next page, when the current one is full.
+func nextPage(u *url.URL, f *todo.TaskFilter, page []todo.Task) (string, bool) {
+	if f.Limit == 0 || len(page) < f.Limit {
+		return "", false
+	}
+
+	q := u.Query()
+	q.Set("after", string(page[len(page)-1].ID))
+	return apiPrefix + "/todos?" + q.Encode(), true
+}
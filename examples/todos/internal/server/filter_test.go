@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+	"todo/internal/todo"
+)
+
+func Test_filterFromQuery(t *testing.T) {
+	f, err := filterFromQuery(url.Values{
+		"done":            {"false"},
+		"deadline_before": {"2024-03-20T18:00:00+01:00"},
+		"q":               {"milk"},
+		"sort":            {"-deadline"},
+		"limit":           {"10"},
+		"after":           {"42"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Done == nil || *f.Done {
+		t.Errorf("expected undone tasks, got: %v", f.Done)
+	}
+
+	if f.DeadlineBefore == nil || f.DeadlineBefore.UTC().Hour() != 17 {
+		t.Errorf("unexpected deadline before: %v", f.DeadlineBefore)
+	}
+
+	if f.TitleContains != "milk" || f.SortBy != todo.SortByDeadline || !f.Descending || f.Limit != 10 || *f.After != "42" {
+		t.Errorf("unexpected filter: %+v", f)
+	}
+
+	for name, q := range map[string]url.Values{
+		"done is not a bool":    {"done": {"maybe"}},
+		"deadline is not a RFC": {"deadline_after": {"yesterday"}},
+		"unknown sort":          {"sort": {"priority"}},
+		"negative limit":        {"limit": {"-1"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := filterFromQuery(q); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
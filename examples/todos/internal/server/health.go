@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+	"todo/internal/logging"
+)
+
+// readyTimeout limits the checks of readiness, so a stuck database makes the probe fail instead of hang
+const readyTimeout = 2 * time.Second
+
+// HandleHealthz reports the process is alive, it never checks the dependencies.
+func (h *Http) HandleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// HandleReadyz reports whether the server can serve the requests. It fails as soon as the server is shutting down,
+// so no new requests are routed to it, and when the check of the config fails, e.g. the database is not reachable.
+func (h *Http) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if h.stopping.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if h.ready != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		err := h.ready(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "checking readiness", logging.Err(err))
+			http.Error(w, "storage not ready", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// VersionResponse describes the build of the binary
+type VersionResponse struct {
+	GoVersion string `json:"go_version"`
+	Path      string `json:"path"`
+	Version   string `json:"version"`
+	// Revision is the commit the binary was built from, empty when built without VCS information, e.g. in tests
+	Revision string          `json:"revision,omitempty"`
+	Time     string          `json:"time,omitempty"`
+	Modified bool            `json:"modified"`
+	Deps     []ModuleVersion `json:"deps"`
+}
+
+type ModuleVersion struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+func (h *Http) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		slog.ErrorContext(r.Context(), "reading build info of a binary built without module support")
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, versionOf(info))
+}
+
+func versionOf(info *debug.BuildInfo) VersionResponse {
+	v := VersionResponse{
+		GoVersion: info.GoVersion,
+		Path:      info.Main.Path,
+		Version:   info.Main.Version,
+		Deps:      make([]ModuleVersion, 0, len(info.Deps)),
+	}
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			v.Revision = s.Value
+		case "vcs.time":
+			v.Time = s.Value
+		case "vcs.modified":
+			v.Modified = s.Value == "true"
+		}
+	}
+
+	for _, d := range info.Deps {
+		// replaced modules report the version actually built
+		if d.Replace != nil {
+			d = d.Replace
+		}
+		v.Deps = append(v.Deps, ModuleVersion{Path: d.Path, Version: d.Version})
+	}
+
+	return v
+}
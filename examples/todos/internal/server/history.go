@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"todo/internal/logging"
+	"todo/internal/todo"
+)
+
+// HistoryModel is the panel with the changes of a task, rendered below the task on the index page
+type HistoryModel struct {
+	ID      string
+	Changes []ChangeModel
+}
+
+type ChangeModel struct {
+	// Description is what the actor did, e.g. renamed to "milk"
+	Description string
+	Actor       string
+	At          time.Time
+	// Ago is the time of the change relative to the time of rendering
+	Ago string
+}
+
+// HandleGetTodoHistory lists the changes of the task, oldest first. The history of a deleted task is kept.
+func (h *Http) HandleGetTodoHistory(w http.ResponseWriter, r *http.Request) {
+	changes, err := h.history(r)
+	if err != nil {
+		jsonErr(w, historyErr(r, err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// renderHistory responds with the fragment of the panel, which the script of the index page shows below the task.
+func (h *Http) renderHistory(w http.ResponseWriter, r *http.Request) {
+	changes, err := h.history(r)
+	if err != nil {
+		httpErr(w, historyErr(r, err))
+		return
+	}
+
+	now := h.now()
+	models := make([]ChangeModel, 0, len(changes))
+	for _, c := range changes {
+		models = append(models, ChangeModel{Description: describe(c), Actor: c.Actor, At: c.At, Ago: approximate(now.Sub(c.At)) + " ago"})
+	}
+
+	err = h.ui.Render(w, HistoryUI, HistoryModel{ID: r.PathValue("id"), Changes: models})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "rendering the history", logging.Err(err))
+	}
+}
+
+func (h *Http) history(r *http.Request) ([]todo.Change, error) {
+	return h.h.History(r.Context(), todo.ID(r.PathValue("id")))
+}
+
+// historyErr logs the error of getting the history and returns the status of the response.
+func historyErr(r *http.Request, err error) int {
+	switch {
+	case errors.Is(err, todo.ErrTaskNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, todo.ErrNoHistory):
+		return http.StatusNotImplemented
+	default:
+		slog.ErrorContext(r.Context(), "getting the history", logging.Err(err))
+		return http.StatusInternalServerError
+	}
+}
+
+// describe tells what the change did to the task, the actor is rendered separately.
+func describe(c todo.Change) string {
+	switch c.Kind {
+	case todo.ChangeCreated:
+		return "created " + strconv.Quote(c.Title)
+	case todo.ChangeRenamed:
+		return "renamed to " + strconv.Quote(c.Title)
+	case todo.ChangeToggled:
+		if c.Done {
+			return "marked as done"
+		}
+		return "marked as not done"
+	case todo.ChangeDeadlineChanged:
+		if c.Deadline == nil {
+			return "removed the deadline"
+		}
+		return "set the deadline to " + c.Deadline.Format("2006-01-02 15:04 -07:00")
+	case todo.ChangeDeleted:
+		return "deleted"
+	default:
+		return string(c.Kind)
+	}
+}
@@ -6,77 +6,208 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log/slog"
-	"math/rand"
 	"net/http"
-	"path"
+	"net/url"
+	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
+	"todo/internal/logging"
+	"todo/internal/metrics"
 	"todo/internal/todo"
 )
 
 type Http struct {
 	srv *http.Server
 	ui  *UI
-	s   todo.Storage
 	h   *todo.Handler
+	// now is a clock used to render relative deadlines
+	now func() time.Time
+	// ready checks the dependencies, see HttpCfg.Ready
+	ready func(ctx context.Context) error
+	// stopping is set as soon as the context of Start is cancelled
+	stopping atomic.Bool
+	// signup is false when the registration is disabled
+	signup            bool
+	static            *assets
+	certFile, keyFile string
+	shutdownTimeout   time.Duration
+	// streams is cancelled when the shutdown starts, so the event streams do not hold it up
+	streams context.Context
+	// heartbeat and writeTimeout of the event streams, see HandleGetEvents
+	heartbeat, writeTimeout time.Duration
 }
 
 type HttpCfg struct {
 	Address string
+	// StaticDir replaces the embedded assets served at /static/, e.g. while editing them. They are read on startup.
+	StaticDir string
+	// CertFile and KeyFile switch the server to HTTPS
+	CertFile, KeyFile string
+	// Timeouts of the http.Server, they protect it from clients holding connections open, like slowloris
+	ReadHeaderTimeout, ReadTimeout, WriteTimeout, IdleTimeout time.Duration
+	// ShutdownTimeout is how long Start waits for the requests in progress before closing their connections
+	ShutdownTimeout time.Duration
+	// Heartbeat is the interval of the comments sent by the idle event streams, so the proxies do not close them
+	Heartbeat time.Duration
+	// MaxHeaderBytes limits the headers of a request
+	MaxHeaderBytes int
+	// MaxBodyBytes limits the body of a request, larger ones are rejected with 413 Request Entity Too Large
+	MaxBodyBytes int64
+	// DisableSignup hides the signup page, so only existing users can log in
+	DisableSignup bool
+	// DisableMetrics does not expose /metrics
+	DisableMetrics bool
+	// Metrics are served at /metrics along with the metrics of the requests, a new registry is created if nil
+	Metrics *metrics.Registry
+	// Ready checks the dependencies of the server in /readyz, e.g. that the database is reachable, nil if there are none
+	Ready func(ctx context.Context) error
 }
 
 var (
+	// defaultCfg replaces the zero fields of the config, so the server is never left without the limits
 	defaultCfg = HttpCfg{
-		Address: ":3456",
+		Address:           ":3456",
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      60 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   10 * time.Second,
+		Heartbeat:         15 * time.Second,
+		MaxHeaderBytes:    64 << 10,
+		MaxBodyBytes:      1 << 20,
 	}
 )
 
-func NewHttp(cfg *HttpCfg, handler *todo.Handler, storage todo.Storage) (*Http, error) {
+// withDefaults returns the config with zero fields set to the defaults.
+func (c HttpCfg) withDefaults() HttpCfg {
+	d := defaultCfg
+	if len(c.Address) == 0 {
+		c.Address = d.Address
+	}
+
+	for _, t := range []struct{ v, d *time.Duration }{
+		{&c.ReadHeaderTimeout, &d.ReadHeaderTimeout},
+		{&c.ReadTimeout, &d.ReadTimeout},
+		{&c.WriteTimeout, &d.WriteTimeout},
+		{&c.IdleTimeout, &d.IdleTimeout},
+		{&c.ShutdownTimeout, &d.ShutdownTimeout},
+		{&c.Heartbeat, &d.Heartbeat},
+	} {
+		if *t.v <= 0 {
+			*t.v = *t.d
+		}
+	}
+
+	if c.MaxHeaderBytes <= 0 {
+		c.MaxHeaderBytes = d.MaxHeaderBytes
+	}
+
+	if c.MaxBodyBytes <= 0 {
+		c.MaxBodyBytes = d.MaxBodyBytes
+	}
+
+	return c
+}
+
+func NewHttp(cfg *HttpCfg, handler *todo.Handler) (*Http, error) {
 	c := defaultCfg
 	if cfg != nil {
-		c = *cfg
+		c = cfg.withDefaults()
+	}
+
+	static, err := newAssets(staticAssets(c.StaticDir))
+	if err != nil {
+		return nil, fmt.Errorf("creating the assets: %w", err)
 	}
 
-	ui, err := NewUI()
+	ui, err := NewUI(static.URL)
 	if err != nil {
 		return nil, fmt.Errorf("creating the UI: %w", err)
 	}
 
-	srv := &Http{ui: ui, s: storage, h: handler}
+	srv := &Http{ui: ui, h: handler, now: time.Now, ready: c.Ready, static: static, signup: !c.DisableSignup}
+	reg := c.Metrics
+	if reg == nil {
+		reg = metrics.NewRegistry()
+	}
 
 	mux := http.NewServeMux()
+	if !c.DisableMetrics {
+		// scraped without authentication, like Prometheus does by default
+		mux.Handle("GET /metrics", reg.Handler())
+	}
+	// probes of the orchestrator, none of them require to log in
+	mux.HandleFunc("GET /healthz", srv.HandleHealthz)
+	mux.HandleFunc("GET /readyz", srv.HandleReadyz)
+	mux.HandleFunc("GET /version", srv.HandleVersion)
 	mux.Handle("GET /static/", http.StripPrefix("/static", srv.StaticHandler()))
-	mux.Handle("/api/", http.StripPrefix("/api", srv.APIHandler()))
-	mux.Handle("/", srv.UIHandler())
+	mux.HandleFunc("GET /login", srv.HandleGetLogin)
+	mux.HandleFunc("POST /login", srv.HandlePostLogin)
+	if srv.signup {
+		mux.HandleFunc("GET /signup", srv.HandleGetSignup)
+		mux.HandleFunc("POST /signup", srv.HandlePostSignup)
+	}
+	mux.HandleFunc("POST /logout", srv.HandlePostLogout)
+	api := srv.APIHandler()
+	mux.Handle(apiPrefix+"/", http.StripPrefix(apiPrefix, srv.bearer(api, srv.authenticate(api, unauthorized))))
+	mux.Handle("/", srv.authenticate(srv.UIHandler(), redirectToLogin))
 
 	srv.srv = &http.Server{
-		Addr:    c.Address,
-		Handler: logRequest(closeBody(mux)),
+		Addr:              c.Address,
+		Handler:           logRequest(newRequestMetrics(reg), secureHeaders(limitBody(c.MaxBodyBytes, closeBody(csrf(routed("", mux)))))),
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
 	}
+	srv.shutdownTimeout = c.ShutdownTimeout
+	srv.certFile, srv.keyFile = c.CertFile, c.KeyFile
+	srv.heartbeat, srv.writeTimeout = c.Heartbeat, c.WriteTimeout
+	var stopStreams context.CancelFunc
+	srv.streams, stopStreams = context.WithCancel(context.Background())
+	srv.srv.RegisterOnShutdown(stopStreams)
 
 	return srv, nil
 }
 
+// Handler serves all the routes, the UI and the API require the user to log in.
+func (h *Http) Handler() http.Handler {
+	return h.srv.Handler
+}
+
 // Start blocks until the server is stopped.
-// It can be stopped by cancelling the context.
+// It can be stopped by cancelling the context, the requests in progress are given HttpCfg.ShutdownTimeout to finish.
 func (h *Http) Start(ctx context.Context) error {
 	errC := make(chan error)
 	go func() {
 		<-ctx.Done()
-		err := h.srv.Shutdown(context.Background())
-		errC <- err
+		h.stopping.Store(true)
+		errC <- h.shutdown()
 	}()
 
+	scheme := "http://"
+	if len(h.certFile) != 0 {
+		scheme = "https://"
+	}
+
 	open := h.srv.Addr
 	if open[0] == ':' {
-		open = "http://localhost" + open
+		open = scheme + "localhost" + open
 	} else {
-		open = "http://" + open
+		open = scheme + open
 	}
 
 	slog.InfoContext(ctx, "starting the server", slog.String("address", h.srv.Addr), slog.String("open", open))
-	err := h.srv.ListenAndServe()
+	var err error
+	if len(h.certFile) != 0 {
+		err = h.srv.ListenAndServeTLS(h.certFile, h.keyFile)
+	} else {
+		err = h.srv.ListenAndServe()
+	}
 	if !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("starting up the server: %w", err)
 	}
@@ -85,104 +216,300 @@ func (h *Http) Start(ctx context.Context) error {
 	return <-errC
 }
 
+// shutdown waits for the requests in progress to finish. Connections still active after the timeout are closed,
+// so a stuck request can not block the exit, and the error reports they were cut off.
+func (h *Http) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.shutdownTimeout)
+	defer cancel()
+
+	err := h.srv.Shutdown(ctx)
+	if err == nil {
+		return nil
+	}
+
+	err = fmt.Errorf("draining connections within: %s, %w", h.shutdownTimeout, err)
+	if cerr := h.srv.Close(); cerr != nil {
+		return errors.Join(err, fmt.Errorf("closing connections, %w", cerr))
+	}
+
+	return err
+}
+
+// StaticHandler serves the scripts and styles of the UI, see assets.
 func (h *Http) StaticHandler() http.Handler {
-	fs := http.FileServer(http.Dir("./static"))
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ext := path.Ext(r.URL.Path)
-		switch ext {
-		case ".css":
-			w.Header().Set("Content-Type", "text/css")
-		case ".js":
-			w.Header().Set("Content-Type", "application/javascript")
-		case ".html":
-			w.Header().Set("Content-Type", "text/html")
-		}
+	return h.static
+}
 
-		fs.ServeHTTP(w, r)
-	})
+// staticAssets are embedded in the binary, so it can be started from any directory, unless dir replaces them.
+func staticAssets(dir string) fs.FS {
+	if len(dir) != 0 {
+		return os.DirFS(dir)
+	}
+
+	// the directory is embedded, so it always exists
+	static, _ := fs.Sub(staticFS, "static")
+	return static
 }
 
 type IndexModel struct {
+	// Title is the name of the rendered list
 	Title string
+	// User is the name of the logged-in user
+	User   string
+	ListID string
+	// Default list of the user can not be archived
+	Default  bool
+	Archived bool
+	// Done is the state of the tasks shown by the active tab, empty if all of them are shown.
+	// Together with the order of the items, it tells the page where the task streamed from the events belongs.
+	Done  string
+	Lists []ListModel
+	Tabs  []TabModel
 	Items []ItemModel
+	// CSRF is sent back by the forms and the scripts of the page, see csrf
+	CSRF string
+}
+
+// ListModel is a link switching to another list on the index page
+type ListModel struct {
+	ID     string
+	Name   string
+	Href   string
+	Active bool
+}
+
+// TabModel is a link filtering the tasks on the index page
+type TabModel struct {
+	Name   string
+	Href   string
+	Active bool
+}
+
+var yes, no = true, false
+
+// tabs of the index page, the key is a value of 'show' query parameter
+var tabs = []struct {
+	show string
+	name string
+	done *bool
+}{
+	{show: "", name: "All"},
+	{show: "active", name: "Active", done: &no},
+	{show: "done", name: "Done", done: &yes},
+}
+
+// indexFilter returns the filter of the tab selected with 'show' query parameter.
+// The tasks are sorted by the deadline, like showItem of index.js sorts the streamed ones.
+func indexFilter(list todo.ListID, show string) (*todo.TaskFilter, []TabModel) {
+	f := &todo.TaskFilter{ListID: &list, SortBy: todo.SortByDeadline}
+	models := make([]TabModel, 0, len(tabs))
+	for _, t := range tabs {
+		active := t.show == show
+		if active {
+			f.Done = t.done
+		}
+
+		href := listPath(list)
+		if len(t.show) != 0 {
+			href += "?show=" + t.show
+		}
+
+		models = append(models, TabModel{Name: t.name, Href: href, Active: active})
+	}
+
+	return f, models
 }
 
 type ItemModel struct {
-	ID      string
-	Title   string
-	Checked bool
+	ID string
+	// ListID tells the page whether the task streamed from the events belongs to the rendered list
+	ListID   string
+	Title    string
+	Checked  bool
+	Deadline *time.Time
+	// Due is a deadline relative to the time of rendering, empty if there is no deadline
+	Due     string
+	Overdue bool
+	// Version is sent back as If-Match, so edits of a stale page are rejected
+	Version int
 }
 
 func (h *Http) UIHandler() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		tasks, err := h.s.List(r.Context(), nil)
-		if err != nil {
-			slog.Error("listing the tasks", slog.String("err", err.Error()))
-			httpErr(w, http.StatusInternalServerError)
-			return
-		}
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		user, _ := todo.UserFromContext(r.Context())
+		h.renderIndex(w, r, todo.DefaultListID(user.ID))
+	})
+	mux.HandleFunc("GET /lists/{id}", func(w http.ResponseWriter, r *http.Request) {
+		h.renderIndex(w, r, todo.ListID(r.PathValue("id")))
+	})
+	mux.HandleFunc("GET /tokens", func(w http.ResponseWriter, r *http.Request) {
+		h.renderTokens(w, r, http.StatusOK, "")
+	})
+	// the index page swaps the fragments of the changed tasks in place
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		h.streamEvents(w, r, h.itemFragment)
+	})
+	mux.HandleFunc("GET /todos/{id}/history", h.renderHistory)
 
-		models := make([]ItemModel, 0, len(tasks))
-		for _, t := range tasks {
-			models = append(models, ItemModel{
-				ID:      string(t.ID),
-				Title:   t.Title,
-				Checked: t.Done,
-			})
-		}
+	return routed("", mux)
+}
 
-		err = h.ui.Render(w, IndexUI, IndexModel{
-			Title: "Sam's tasks",
-			Items: models,
-		})
+func (h *Http) renderIndex(w http.ResponseWriter, r *http.Request, id todo.ListID) {
+	ctx := r.Context()
+	list, err := h.h.GetList(ctx, id)
+	if errors.Is(err, todo.ErrListNotFound) {
+		httpErr(w, http.StatusNotFound)
+		return
+	}
 
-		if err != nil {
-			slog.Error("rendering the index", slog.String("err", err.Error()))
-			httpErr(w, http.StatusInternalServerError)
-		}
+	if err != nil {
+		slog.ErrorContext(ctx, "getting the list", logging.Err(err))
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	lists, err := h.h.Lists(ctx, false)
+	if err != nil {
+		slog.ErrorContext(ctx, "listing the lists", logging.Err(err))
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	filter, tabs := indexFilter(id, r.URL.Query().Get("show"))
+	tasks, err := h.h.List(ctx, filter)
+	if err != nil {
+		slog.ErrorContext(ctx, "listing the tasks", logging.Err(err))
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	now := h.now()
+	models := make([]ItemModel, 0, len(tasks))
+	for _, t := range tasks {
+		models = append(models, newItemModel(t, now))
+	}
+
+	listModels := make([]ListModel, 0, len(lists))
+	for _, l := range lists {
+		listModels = append(listModels, ListModel{ID: string(l.ID), Name: l.Name, Href: listPath(l.ID), Active: l.ID == id})
+	}
+
+	var done string
+	if filter.Done != nil {
+		done = strconv.FormatBool(*filter.Done)
+	}
+
+	user, _ := todo.UserFromContext(ctx)
+	err = h.ui.Render(w, IndexUI, IndexModel{
+		Title:    list.Name,
+		User:     user.Name,
+		ListID:   string(list.ID),
+		Default:  list.ID == todo.DefaultListID(list.OwnerID),
+		Archived: list.Archived,
+		Done:     done,
+		Lists:    listModels,
+		Tabs:     tabs,
+		Items:    models,
+		CSRF:     csrfToken(ctx),
 	})
 
-	return mux
+	if err != nil {
+		slog.ErrorContext(ctx, "rendering the index", logging.Err(err))
+		httpErr(w, http.StatusInternalServerError)
+	}
+}
+
+func listPath(id todo.ListID) string {
+	return "/lists/" + url.PathEscape(string(id))
+}
+
+func newItemModel(t todo.Task, now time.Time) ItemModel {
+	m := ItemModel{
+		ID:       string(t.ID),
+		ListID:   string(t.ListID),
+		Title:    t.Title,
+		Checked:  t.Done,
+		Deadline: t.Deadline,
+		Version:  t.Version,
+	}
+
+	if t.Deadline != nil {
+		m.Due = relativeDue(*t.Deadline, now)
+		m.Overdue = !t.Done && t.Deadline.Before(now)
+	}
+
+	return m
 }
 
 func (h *Http) APIHandler() http.Handler {
 	mux := http.NewServeMux()
+	mux.HandleFunc("GET /todos", h.HandleGetTodos)
+	mux.HandleFunc("GET /todos/{id}", h.HandleGetTodo)
 	mux.HandleFunc("POST /todos", h.HandlePostTodo)
+	mux.HandleFunc("PATCH /todos/{id}", h.HandlePatchTodo)
+	mux.HandleFunc("DELETE /todos/{id}", h.HandleDeleteTodo)
+	mux.HandleFunc("GET /todos/{id}/history", h.HandleGetTodoHistory)
 	mux.HandleFunc("PUT /todos/{id}/toggle", h.HandlePostTodoToggle)
-	return mux
+	mux.HandleFunc("GET /events", h.HandleGetEvents)
+	mux.HandleFunc("GET /lists", h.HandleGetLists)
+	mux.HandleFunc("GET /lists/{id}", h.HandleGetList)
+	mux.HandleFunc("POST /lists", h.HandlePostList)
+	mux.HandleFunc("PATCH /lists/{id}", h.HandlePatchList)
+	mux.HandleFunc("GET /tokens", h.HandleGetTokens)
+	mux.HandleFunc("POST /tokens", h.HandlePostToken)
+	mux.HandleFunc("DELETE /tokens/{id}", h.HandleDeleteToken)
+	return routed(apiPrefix, mux)
 }
 
+// HandlePostTodo accepts either a JSON body or a form submitted from the index page.
+// The form submitted by the script of the page is answered with the fragment of the created task, see wantsFragment.
 func (h *Http) HandlePostTodo(w http.ResponseWriter, r *http.Request) {
+	if hasJSONBody(r) {
+		h.handlePostTodoJSON(w, r)
+		return
+	}
+
 	ctx := r.Context()
 	err := r.ParseForm()
 	if err != nil {
-		slog.ErrorContext(ctx, "parsing the form", slog.String("err", err.Error()))
-		httpErr(w, http.StatusBadRequest)
+		slog.ErrorContext(ctx, "parsing the form", logging.Err(err))
+		httpErr(w, readErr(err))
 		return
 	}
 
-	title := r.Form.Get("todo")
-	if len(title) == 0 {
-		slog.InfoContext(ctx, "empty todo field")
+	deadline, err := parseDeadline(r.Form.Get("deadline"), r.Form.Get("tz"))
+	if err != nil {
+		slog.InfoContext(ctx, "parsing the deadline", logging.Err(err))
 		httpErr(w, http.StatusBadRequest)
 		return
 	}
 
-	task := todo.Task{
-		ID:    todo.RandomID(),
-		Title: title,
-		Done:  false,
+	list := todo.ListID(r.Form.Get("list"))
+	stored, err := h.h.Create(ctx, todo.CreateTask{Title: r.Form.Get("todo"), Deadline: deadline, ListID: list})
+	if errors.Is(err, todo.ErrInvalidTask) {
+		slog.InfoContext(ctx, "invalid task", logging.Err(err))
+		httpErr(w, http.StatusBadRequest)
+		return
 	}
 
-	_, err = h.s.Upsert(ctx, task)
 	if err != nil {
-		slog.ErrorContext(ctx, "upserting the task", slog.String("err", err.Error()))
+		slog.ErrorContext(ctx, "creating the task", logging.Err(err))
 		httpErr(w, http.StatusInternalServerError)
 		return
 	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	if wantsFragment(r) {
+		w.Header().Set("Location", taskLocation(stored.ID))
+		h.renderItem(w, r, http.StatusCreated, stored)
+		return
+	}
+
+	redirect := "/"
+	if len(list) != 0 {
+		redirect = listPath(list)
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
 }
 
 func (h *Http) HandlePostTodoToggle(w http.ResponseWriter, r *http.Request) {
@@ -193,21 +520,61 @@ func (h *Http) HandlePostTodoToggle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := h.h.Toggle(r.Context(), todo.ID(id))
+	version, status := h.ifMatch(r, todo.ID(id))
+	if status != 0 {
+		httpErr(w, status)
+		return
+	}
+
+	toggled, err := h.h.Toggle(r.Context(), todo.ID(id), version)
 	if errors.Is(err, todo.ErrTaskNotFound) {
 		httpErr(w, http.StatusNotFound)
 		return
 	}
 
+	if errors.Is(err, todo.ErrStaleTask) {
+		httpErr(w, http.StatusPreconditionFailed)
+		return
+	}
+
 	if err != nil {
-		slog.ErrorContext(r.Context(), "upserting the task", slog.String("err", err.Error()))
+		slog.ErrorContext(r.Context(), "upserting the task", logging.Err(err))
 		httpErr(w, http.StatusInternalServerError)
 		return
 	}
 
+	if acceptsJSON(r) {
+		w.Header().Set("ETag", etag(toggled))
+		writeJSON(w, http.StatusOK, toggled)
+		return
+	}
+
+	if wantsFragment(r) {
+		h.renderItem(w, r, http.StatusOK, toggled)
+		return
+	}
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// wantsFragment reports whether the request is sent by a script of the page, like fetch or htmx,
+// which swaps the rendered task in place instead of following a redirect to the whole page.
+func wantsFragment(r *http.Request) bool {
+	scripted := r.Header.Get("HX-Request") == "true" || r.Header.Get("X-Requested-With") == "XMLHttpRequest"
+	return scripted && !acceptsJSON(r)
+}
+
+// renderItem responds with the fragment of the stored task, so the page shows the state of the storage
+// and not the state the script expects.
+func (h *Http) renderItem(w http.ResponseWriter, r *http.Request, status int, t todo.Task) {
+	w.Header().Set("ETag", etag(t))
+	err := h.ui.RenderStatus(w, status, ItemUI, newItemModel(t, h.now()))
+	if err != nil {
+		// the status is already sent
+		slog.ErrorContext(r.Context(), "rendering the item", logging.Err(err))
+	}
+}
+
 func httpErr(w http.ResponseWriter, status int) {
 	http.Error(w, http.StatusText(status), status)
 }
@@ -217,14 +584,19 @@ type UI struct {
 }
 
 const (
-	IndexUI = "index"
+	IndexUI   = "index"
+	ItemUI    = "item"
+	HistoryUI = "history"
+	LoginUI   = "login"
+	TokensUI  = "tokens"
 )
 
-//go:embed ui/*
+//go:embed ui/*.gohtml
 var uiFS embed.FS
 
-func NewUI() (*UI, error) {
-	tpl, err := template.ParseFS(uiFS, "ui/*.gohtml")
+// NewUI parses the templates, which link the assets by the URLs returned from asset func.
+func NewUI(asset func(name string) string) (*UI, error) {
+	tpl, err := template.New("ui").Funcs(template.FuncMap{"asset": asset}).ParseFS(uiFS, "ui/*.gohtml")
 	if err != nil {
 		return nil, fmt.Errorf("parsing the template from embedded filesystem, %w", err)
 	}
@@ -233,53 +605,37 @@ func NewUI() (*UI, error) {
 }
 
 func (u *UI) Render(w http.ResponseWriter, name string, data interface{}) error {
+	return u.RenderStatus(w, http.StatusOK, name, data)
+}
+
+// RenderStatus renders the template with the status other than 200 OK, e.g. a form with validation errors.
+func (u *UI) RenderStatus(w http.ResponseWriter, status int, name string, data interface{}) error {
 	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(status)
 	return u.tpl.ExecuteTemplate(w, name, data)
 }
 
-var (
-	seed = time.Now().UnixNano()
-	src  = rand.NewSource(seed)
-)
-
-type ridKey string
-
-const RequestID = ridKey("request-id")
-
-func logRequest(h http.Handler) http.Handler {
+// limitBody rejects bodies larger than max bytes, reading them fails with *http.MaxBytesError, see readErr.
+func limitBody(max int64, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		rid := strconv.Itoa(int(src.Int63()))
-		ctx := context.WithValue(r.Context(), RequestID, rid)
-		defer func() {
-			slog.InfoContext(ctx, "finished request", slog.String("id", rid), slog.String("took", time.Since(start).String()))
-		}()
-		slog.InfoContext(ctx, "received request", slog.String("id", rid), slog.String("method", r.Method), slog.String("url", r.URL.String()))
-		h.ServeHTTP(w, r.WithContext(ctx))
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		h.ServeHTTP(w, r)
 	})
 }
 
+// readErr is the status of a request, whose body failed to be read or parsed.
+func readErr(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
+
 func closeBody(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 		h.ServeHTTP(w, r)
 	})
 }
-
-type storage struct {
-	m map[string]todo.Task
-}
-
-func (s *storage) Upsert(ctx context.Context, t todo.Task) (stored todo.Task, err error) {
-	slog.InfoContext(ctx, "upserting the task", slog.String("id", string(t.ID)))
-	s.m[string(t.ID)] = t
-	return t, nil
-}
-
-func (s *storage) List(ctx context.Context) ([]todo.Task, error) {
-	tasks := make([]todo.Task, 0, len(s.m))
-	for _, t := range s.m {
-		tasks = append(tasks, t)
-	}
-	return tasks, nil
-}
@@ -1,13 +1,27 @@
 package server_test
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/goleak"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+	"todo/internal/memory"
 	"todo/internal/server"
 	"todo/internal/todo"
 )
@@ -33,36 +47,45 @@ func (l *loggingTransport) RoundTrip(request *http.Request) (r *http.Response, e
 	return l.next.RoundTrip(request)
 }
 
-// compile-time guarantee, that *testStorage implements Storage interface
-var _ todo.Storage = &testStorage{}
-
-type testStorage struct {
-	tasks map[todo.ID]todo.Task
+// csrfTransport sends the CSRF token from the cookie in the header, like index.js does with the token rendered in the page
+type csrfTransport struct {
+	jar  http.CookieJar
+	next http.RoundTripper
 }
 
-func newTestStorage() *testStorage {
-	return &testStorage{tasks: make(map[todo.ID]todo.Task)}
-}
+func (c *csrfTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	for _, cookie := range c.jar.Cookies(r.URL) {
+		if cookie.Name == "csrf" {
+			r = r.Clone(r.Context())
+			r.Header.Set("X-CSRF-Token", cookie.Value)
+		}
+	}
 
-func (s *testStorage) Upsert(ctx context.Context, t todo.Task) (stored todo.Task, err error) {
-	s.tasks[t.ID] = t
-	return t, nil
+	return c.next.RoundTrip(r)
 }
 
-func (s *testStorage) List(ctx context.Context, f *todo.TaskFilter) ([]todo.Task, error) {
-	out := make([]todo.Task, 0, len(s.tasks))
-	for _, task := range s.tasks {
-		out = append(out, task)
+// newBrowser returns a client with its own cookies, so every browser is logged in as a different user.
+// It does not follow redirects.
+func newBrowser(t *testing.T, srv *httptest.Server) *http.Client {
+	jar := mustT[*cookiejar.Jar](t)(cookiejar.New(nil))
+	c := &http.Client{
+		Transport: &csrfTransport{jar: jar, next: newLoggingTransport(t)},
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
 	}
 
-	return out, nil
+	// the first page sets the CSRF cookie
+	must(c.Get(srv.URL + "/login")).Body.Close()
+	return c
 }
 
 // integration-like test for the 'backend' API, which spins-up an actual server
 func Test_APIHandler(t *testing.T) {
-	s := newTestStorage()
-	h := todo.NewHandler(s)
-	api := must(server.NewHttp(nil, h, s))
+	s := memory.NewTaskStorage()
+	h := todo.NewHandler(s, s, s)
+	api := must(server.NewHttp(nil, h))
 
 	srv := httptest.NewServer(api.APIHandler())
 	client := srv.Client()
@@ -95,6 +118,1148 @@ func Test_APIHandler(t *testing.T) {
 	}
 }
 
+func Test_UIHandler_Deadlines(t *testing.T) {
+	s := memory.NewTaskStorage()
+	h := todo.NewHandler(s, s, s)
+	api := must(server.NewHttp(nil, h))
+
+	past := time.Now().Add(-49 * time.Hour)
+	future := time.Now().Add(time.Hour + time.Minute)
+	must(s.Upsert(context.Background(), todo.Task{ID: "late", Title: "late", Deadline: &past, ListID: todo.DefaultListID("")}))
+	must(s.Upsert(context.Background(), todo.Task{ID: "soon", Title: "soon", Deadline: &future, ListID: todo.DefaultListID("")}))
+
+	rec := httptest.NewRecorder()
+	api.UIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := rec.Body.String()
+	for _, expected := range []string{"overdue by 2 days", "due in 1 hour", "text-red-400"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected the index to contain: %q", expected)
+		}
+	}
+}
+
+// scripts of the page get the fragment of the task to swap in place, forms without scripts are redirected
+func Test_APIHandler_Fragments(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s))).APIHandler()
+
+	serve := func(method, path, contentType string, body string, header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		return rec
+	}
+
+	form := "application/x-www-form-urlencoded"
+	rec := serve(http.MethodPost, "/todos", form, url.Values{"todo": {"fragment"}}.Encode(), "X-Requested-With", "XMLHttpRequest")
+	if rec.Code != http.StatusCreated || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected created fragment, status: %d, type: %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	location := rec.Header().Get("Location")
+	id := strings.TrimPrefix(location, "/api/todos/")
+	if body := rec.Body.String(); !strings.Contains(body, `id="item-`+id+`"`) || strings.Contains(body, "<html") {
+		t.Errorf("expected only the item: %s, got: %s", id, body)
+	}
+
+	for name, tc := range map[string]struct {
+		method, path, contentType, body string
+		header                          []string
+		status                          int
+		expected                        string
+	}{
+		"toggle by htmx": {
+			method: http.MethodPut, path: "/todos/" + id + "/toggle",
+			header: []string{"HX-Request", "true"},
+			status: http.StatusOK, expected: `id="item-` + id + `"`,
+		},
+		"toggle by form": {
+			method: http.MethodPut, path: "/todos/" + id + "/toggle",
+			status: http.StatusSeeOther,
+		},
+		"toggle by JSON client": {
+			method: http.MethodPut, path: "/todos/" + id + "/toggle",
+			header: []string{"X-Requested-With", "XMLHttpRequest", "Accept", "application/json"},
+			status: http.StatusOK, expected: `"done":`,
+		},
+		"patch by script": {
+			method: http.MethodPatch, path: "/todos/" + id, contentType: "application/json", body: `{"title": "renamed"}`,
+			header: []string{"X-Requested-With", "XMLHttpRequest", "Accept", "text/html"},
+			status: http.StatusOK, expected: "renamed",
+		},
+		"patch by JSON client": {
+			method: http.MethodPatch, path: "/todos/" + id, contentType: "application/json", body: `{"title": "json"}`,
+			status: http.StatusOK, expected: `"title":"json"`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := serve(tc.method, tc.path, tc.contentType, tc.body, tc.header...)
+			if rec.Code != tc.status {
+				t.Fatalf("expected status: %d, got: %d", tc.status, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), tc.expected) {
+				t.Errorf("expected the response to contain: %s, got: %s", tc.expected, rec.Body.String())
+			}
+		})
+	}
+}
+
+func Test_APIHandler_Lists(t *testing.T) {
+	s := memory.NewTaskStorage()
+	h := todo.NewHandler(s, s, s)
+	api := must(server.NewHttp(nil, h))
+
+	srv := httptest.NewServer(api.APIHandler())
+	defer srv.Close()
+	client := srv.Client()
+	client.Transport = newLoggingTransport(t)
+
+	resp := mustT[*http.Response](t)(client.Post(srv.URL+"/lists", "application/json", strings.NewReader(`{"name":"Shopping"}`)))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status: %d, actual: %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	shopping := decode[todo.List](t, resp)
+	if shopping.Name != "Shopping" || shopping.Archived {
+		t.Errorf("unexpected created list: %+v", shopping)
+	}
+
+	body := `{"title":"milk","list_id":"` + string(shopping.ID) + `"}`
+	resp = mustT[*http.Response](t)(client.Post(srv.URL+"/todos", "application/json", strings.NewReader(body)))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status: %d, actual: %d", http.StatusCreated, resp.StatusCode)
+	}
+	must(client.Post(srv.URL+"/todos", "application/json", strings.NewReader(`{"title":"laundry"}`)))
+
+	resp = mustT[*http.Response](t)(client.Get(srv.URL + "/todos?list=" + string(shopping.ID)))
+	if tasks := decode[[]todo.Task](t, resp); len(tasks) != 1 || tasks[0].Title != "milk" {
+		t.Errorf("expected only the task of the list, got: %+v", tasks)
+	}
+
+	ui := httptest.NewRecorder()
+	api.UIHandler().ServeHTTP(ui, httptest.NewRequest(http.MethodGet, "/lists/"+string(shopping.ID), nil))
+	if page := ui.Body.String(); !strings.Contains(page, "Shopping") || !strings.Contains(page, "milk") || strings.Contains(page, "laundry") {
+		t.Errorf("expected the page of the list with just its task, got: %s", page)
+	}
+
+	patch := func(id todo.ListID, body string) *http.Response {
+		req := mustT[*http.Request](t)(http.NewRequest(http.MethodPatch, srv.URL+"/lists/"+string(id), strings.NewReader(body)))
+		req.Header.Set("Content-Type", "application/json")
+		return mustT[*http.Response](t)(client.Do(req))
+	}
+
+	resp = patch(shopping.ID, `{"name":"Groceries","archived":true}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status: %d, actual: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if patched := decode[todo.List](t, resp); patched.Name != "Groceries" || !patched.Archived {
+		t.Errorf("unexpected patched list: %+v", patched)
+	}
+
+	resp = mustT[*http.Response](t)(client.Post(srv.URL+"/todos", "application/json", strings.NewReader(body)))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected tasks not to be added to archived list, status: %d", resp.StatusCode)
+	}
+
+	resp = mustT[*http.Response](t)(client.Get(srv.URL + "/lists"))
+	if lists := decode[[]todo.List](t, resp); len(lists) != 1 || lists[0].ID != todo.DefaultListID("") {
+		t.Errorf("expected archived list to be hidden, got: %+v", lists)
+	}
+
+	if resp = patch(todo.DefaultListID(""), `{"archived":true}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected default list not to be archived, status: %d", resp.StatusCode)
+	}
+
+	if resp = patch(todo.DefaultListID(""), `{"name":"Renamed","archived":true}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected default list not to be archived, status: %d", resp.StatusCode)
+	}
+
+	resp = mustT[*http.Response](t)(client.Get(srv.URL + "/lists/" + string(todo.DefaultListID(""))))
+	if l := decode[todo.List](t, resp); l.Name == "Renamed" || l.Archived {
+		t.Errorf("expected rejected patch to change nothing, got: %+v", l)
+	}
+
+	if resp = patch("unknown", `{"name":"x"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status: %d, actual: %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+// every user sees just their own tasks
+func Test_Accounts(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	post := func(c *http.Client, path string, form url.Values) *http.Response {
+		return mustT[*http.Response](t)(c.PostForm(srv.URL+path, form))
+	}
+
+	alice, bob := newBrowser(t, srv), newBrowser(t, srv)
+	if resp := mustT[*http.Response](t)(alice.Get(srv.URL + "/api/todos")); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected API to require login, status: %d", resp.StatusCode)
+	}
+
+	if resp := mustT[*http.Response](t)(alice.Get(srv.URL + "/")); resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/login" {
+		t.Errorf("expected UI to redirect to login, status: %d, location: %s", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	for _, c := range []struct {
+		client *http.Client
+		name   string
+	}{{alice, "alice"}, {bob, "bob"}} {
+		if resp := post(c.client, "/signup", url.Values{"name": {c.name}, "password": {"correct horse"}}); resp.StatusCode != http.StatusSeeOther {
+			t.Fatalf("signing up: %s, status: %d", c.name, resp.StatusCode)
+		}
+	}
+
+	if resp := post(bob, "/signup", url.Values{"name": {"Alice"}, "password": {"correct horse"}}); resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected names to be unique, status: %d", resp.StatusCode)
+	}
+
+	resp := mustT[*http.Response](t)(alice.Post(srv.URL+"/api/todos", "application/json", strings.NewReader(`{"title":"secret"}`)))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status: %d, actual: %d", http.StatusCreated, resp.StatusCode)
+	}
+	secret := decode[todo.Task](t, resp)
+
+	resp = mustT[*http.Response](t)(bob.Get(srv.URL + "/api/todos"))
+	if tasks := decode[[]todo.Task](t, resp); len(tasks) != 0 {
+		t.Errorf("expected bob not to see tasks of alice, got: %+v", tasks)
+	}
+
+	req := mustT[*http.Request](t)(http.NewRequest(http.MethodPut, srv.URL+"/api/todos/"+string(secret.ID)+"/toggle", nil))
+	if resp = mustT[*http.Response](t)(bob.Do(req)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected bob not to toggle tasks of alice, status: %d", resp.StatusCode)
+	}
+
+	resp = mustT[*http.Response](t)(alice.Post(srv.URL+"/api/lists", "application/json", strings.NewReader(`{"name":"Diary"}`)))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status: %d, actual: %d", http.StatusCreated, resp.StatusCode)
+	}
+	diary := decode[todo.List](t, resp)
+
+	resp = mustT[*http.Response](t)(bob.Get(srv.URL + "/api/lists?archived=true"))
+	if lists := decode[[]todo.List](t, resp); len(lists) != 1 || lists[0].ID == diary.ID || lists[0].ID == secret.ListID || lists[0].Name != "bob's tasks" {
+		t.Errorf("expected bob to see just his default list, got: %+v", lists)
+	}
+
+	page := string(mustT[[]byte](t)(io.ReadAll(mustT[*http.Response](t)(bob.Get(srv.URL + "/")).Body)))
+	if strings.Contains(page, "Diary") || strings.Contains(page, "alice") {
+		t.Errorf("expected the index of bob not to show the lists of alice, got: %s", page)
+	}
+
+	for _, id := range []todo.ListID{diary.ID, secret.ListID} {
+		if resp = mustT[*http.Response](t)(bob.Get(srv.URL + "/api/lists/" + string(id))); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected bob not to see list: %s of alice, status: %d", id, resp.StatusCode)
+		}
+
+		if resp = mustT[*http.Response](t)(bob.Get(srv.URL + "/lists/" + string(id))); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected bob not to see the page of list: %s of alice, status: %d", id, resp.StatusCode)
+		}
+
+		req = mustT[*http.Request](t)(http.NewRequest(http.MethodPatch, srv.URL+"/api/lists/"+string(id), strings.NewReader(`{"name":"bob's now","archived":true}`)))
+		req.Header.Set("Content-Type", "application/json")
+		if resp = mustT[*http.Response](t)(bob.Do(req)); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected bob not to patch list: %s of alice, status: %d", id, resp.StatusCode)
+		}
+
+		body := `{"title":"planted","list_id":"` + string(id) + `"}`
+		if resp = mustT[*http.Response](t)(bob.Post(srv.URL+"/api/todos", "application/json", strings.NewReader(body))); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected bob not to add tasks to list: %s of alice, status: %d", id, resp.StatusCode)
+		}
+	}
+
+	resp = mustT[*http.Response](t)(alice.Get(srv.URL + "/api/lists"))
+	if lists := decode[[]todo.List](t, resp); len(lists) != 2 || lists[0].Name != "alice's tasks" || lists[1] != diary {
+		t.Errorf("expected alice to see her untouched lists, got: %+v", lists)
+	}
+
+	resp = mustT[*http.Response](t)(alice.Get(srv.URL + "/api/todos"))
+	if tasks := decode[[]todo.Task](t, resp); len(tasks) != 1 || tasks[0].Done {
+		t.Errorf("expected alice to see her untouched task, got: %+v", tasks)
+	}
+
+	if resp = post(alice, "/logout", nil); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("logging out, status: %d", resp.StatusCode)
+	}
+
+	if resp = mustT[*http.Response](t)(alice.Get(srv.URL + "/api/todos")); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected session to end on logout, status: %d", resp.StatusCode)
+	}
+
+	if resp = post(alice, "/login", url.Values{"name": {"alice"}, "password": {"wrong horse"}}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected wrong password to be rejected, status: %d", resp.StatusCode)
+	}
+
+	if resp = post(alice, "/login", url.Values{"name": {"alice"}, "password": {"correct horse"}}); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("logging in, status: %d", resp.StatusCode)
+	}
+
+	if resp = mustT[*http.Response](t)(alice.Get(srv.URL + "/")); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected logged in user to see the index, status: %d", resp.StatusCode)
+	}
+}
+
+func Test_CSRF(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	browser := newBrowser(t, srv)
+	must(browser.PostForm(srv.URL+"/signup", url.Values{"name": {"alice"}, "password": {"correct horse"}}))
+
+	// a cross-site page can make the browser send the cookies, but it can not read the token
+	forged := &http.Client{Jar: browser.Jar, Transport: newLoggingTransport(t)}
+	resp := mustT[*http.Response](t)(forged.PostForm(srv.URL+"/api/todos", url.Values{"todo": {"forged"}}))
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forged form to be rejected, status: %d", resp.StatusCode)
+	}
+
+	req := mustT[*http.Request](t)(http.NewRequest(http.MethodPut, srv.URL+"/api/todos/any/toggle", nil))
+	if resp = mustT[*http.Response](t)(forged.Do(req)); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected forged toggle to be rejected, status: %d", resp.StatusCode)
+	}
+
+	page := string(mustT[[]byte](t)(io.ReadAll(mustT[*http.Response](t)(browser.Get(srv.URL + "/")).Body)))
+	_, rest, _ := strings.Cut(page, `<meta name="csrf-token" content="`)
+	token, _, _ := strings.Cut(rest, `"`)
+	if len(token) == 0 {
+		t.Fatal("expected the token in the page")
+	}
+
+	// the client follows the redirect to the index
+	resp = mustT[*http.Response](t)(forged.PostForm(srv.URL+"/api/todos", url.Values{"todo": {"genuine"}, "csrf": {token}}))
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the form with the token to be accepted, status: %d", resp.StatusCode)
+	}
+
+	resp = mustT[*http.Response](t)(browser.Get(srv.URL + "/api/todos"))
+	if tasks := decode[[]todo.Task](t, resp); len(tasks) != 1 || tasks[0].Title != "genuine" {
+		t.Errorf("expected just the genuine task, got: %+v", tasks)
+	}
+}
+
+func Test_RequestID(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	client := &http.Client{Transport: newLoggingTransport(t)}
+	for name, tc := range map[string]struct {
+		header   string
+		expected string
+	}{
+		"incoming id is echoed":   {header: "proxy-1234", expected: "proxy-1234"},
+		"missing id is generated": {},
+		"invalid id is replaced":  {header: "with space", expected: ""},
+		"long id is replaced":     {header: strings.Repeat("x", 200), expected: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := mustT[*http.Request](t)(http.NewRequest(http.MethodGet, srv.URL+"/login", nil))
+			if len(tc.header) != 0 {
+				req.Header.Set("X-Request-ID", tc.header)
+			}
+
+			rid := mustT[*http.Response](t)(client.Do(req)).Header.Get("X-Request-ID")
+			if len(rid) == 0 {
+				t.Fatal("expected the id in the response")
+			}
+
+			if len(tc.expected) != 0 && rid != tc.expected {
+				t.Errorf("expected id: %s, got: %s", tc.expected, rid)
+			}
+
+			if len(tc.expected) == 0 && rid == tc.header {
+				t.Errorf("expected a generated id, got: %s", rid)
+			}
+		})
+	}
+}
+
+func Test_AccessLog(t *testing.T) {
+	logs := &bytes.Buffer{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	browser := newBrowser(t, srv)
+	must(browser.PostForm(srv.URL+"/signup", url.Values{"name": {"alice"}, "password": {"correct horse"}}))
+
+	for name, tc := range map[string]struct {
+		path   string
+		route  string
+		status int
+	}{
+		"page":          {path: "/login", route: "GET /login", status: http.StatusOK},
+		"nested route":  {path: "/api/todos/missing", route: "GET /api/todos/{id}", status: http.StatusNotFound},
+		"ui route":      {path: "/", route: "GET /{$}", status: http.StatusOK},
+		"unknown route": {path: "/api/nothing", route: "/api/", status: http.StatusNotFound},
+	} {
+		t.Run(name, func(t *testing.T) {
+			logs.Reset()
+			resp := mustT[*http.Response](t)(browser.Get(srv.URL + tc.path))
+			size := len(mustT[[]byte](t)(io.ReadAll(resp.Body)))
+
+			var entry struct {
+				Route     string `json:"route"`
+				Status    int    `json:"status"`
+				Bytes     int    `json:"bytes"`
+				Remote    string `json:"remote"`
+				UserAgent string `json:"user_agent"`
+				Latency   int64  `json:"latency"`
+			}
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				if strings.Contains(line, `"msg":"finished request"`) {
+					if err := json.Unmarshal([]byte(line), &entry); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if entry.Route != tc.route || entry.Status != tc.status || entry.Bytes != size {
+				t.Errorf("expected route: %s, status: %d, bytes: %d, got: %+v", tc.route, tc.status, size, entry)
+			}
+
+			if len(entry.Remote) == 0 || !strings.HasPrefix(entry.UserAgent, "Go-http-client") || entry.Latency <= 0 {
+				t.Errorf("expected remote address, user agent and latency, got: %+v", entry)
+			}
+		})
+	}
+}
+
+func Test_Metrics(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	client := &http.Client{Transport: newLoggingTransport(t)}
+	must(client.Get(srv.URL + "/login"))
+	must(client.Get(srv.URL + "/login"))
+
+	resp := mustT[*http.Response](t)(client.Get(srv.URL + "/metrics"))
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("expected the text format of Prometheus, got: %s", ct)
+	}
+
+	body := string(mustT[[]byte](t)(io.ReadAll(resp.Body)))
+	for _, expected := range []string{
+		`http_requests_total{route="GET /login",status="200"} 2`,
+		`http_request_duration_seconds_count{route="GET /login",status="200"} 2`,
+		`http_request_duration_seconds_bucket{route="GET /login",status="200",le="+Inf"} 2`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected: %s in the metrics:\n%s", expected, body)
+		}
+	}
+}
+
+func Test_Probes(t *testing.T) {
+	s := memory.NewTaskStorage()
+	var notReady error
+	api := must(server.NewHttp(&server.HttpCfg{
+		Address: "127.0.0.1:0",
+		Ready:   func(ctx context.Context) error { return notReady },
+	}, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	client := &http.Client{Transport: newLoggingTransport(t)}
+	status := func(path string) int {
+		t.Helper()
+		return mustT[*http.Response](t)(client.Get(srv.URL + path)).StatusCode
+	}
+
+	if code := status("/healthz"); code != http.StatusOK {
+		t.Errorf("expected alive, status: %d", code)
+	}
+
+	if code := status("/readyz"); code != http.StatusOK {
+		t.Errorf("expected ready, status: %d", code)
+	}
+
+	notReady = errors.New("database is gone")
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready with failing check, status: %d", code)
+	}
+
+	notReady = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- api.Start(ctx) }()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected not ready after shutdown, status: %d", code)
+	}
+
+	resp := mustT[*http.Response](t)(client.Get(srv.URL + "/version"))
+	if v := decode[server.VersionResponse](t, resp); v.GoVersion != runtime.Version() {
+		t.Errorf("expected go version: %s, got: %+v", runtime.Version(), v)
+	}
+}
+
+func Test_DisabledFeatures(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(&server.HttpCfg{DisableSignup: true, DisableMetrics: true}, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	browser := newBrowser(t, srv)
+	for _, path := range []string{"/signup", "/metrics"} {
+		// unknown pages require to log in
+		if resp := mustT[*http.Response](t)(browser.Get(srv.URL + path)); resp.StatusCode != http.StatusSeeOther {
+			t.Errorf("expected %s to be disabled, status: %d", path, resp.StatusCode)
+		}
+	}
+
+	page := string(mustT[[]byte](t)(io.ReadAll(mustT[*http.Response](t)(browser.Get(srv.URL + "/login")).Body)))
+	if strings.Contains(page, `href="/signup"`) {
+		t.Error("expected no link to the disabled signup")
+	}
+}
+
+func Test_BodyLimit(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(&server.HttpCfg{MaxBodyBytes: 256}, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	browser := newBrowser(t, srv)
+	must(browser.PostForm(srv.URL+"/signup", url.Values{"name": {"alice"}, "password": {"correct horse"}}))
+
+	long := strings.Repeat("x", 512)
+	resp := mustT[*http.Response](t)(browser.Post(srv.URL+"/api/todos", "application/json", strings.NewReader(`{"title": "`+long+`"}`)))
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected large JSON to be rejected, status: %d", resp.StatusCode)
+	}
+
+	// the form is parsed by the CSRF check before reaching the handler
+	resp = mustT[*http.Response](t)(browser.PostForm(srv.URL+"/api/todos", url.Values{"todo": {long}}))
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected large form to be rejected, status: %d", resp.StatusCode)
+	}
+
+	resp = mustT[*http.Response](t)(browser.Post(srv.URL+"/api/todos", "application/json", strings.NewReader(`{"title": "small"}`)))
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected small JSON to be accepted, status: %d", resp.StatusCode)
+	}
+}
+
+// a client, which never finishes its request, must not block the shutdown
+func Test_ShutdownTimeout(t *testing.T) {
+	l := mustT[net.Listener](t)(net.Listen("tcp", "127.0.0.1:0"))
+	addr := l.Addr().String()
+	l.Close()
+
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(&server.HttpCfg{Address: addr, ShutdownTimeout: 50 * time.Millisecond}, todo.NewHandler(s, s, s)))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- api.Start(ctx) }()
+
+	var conn net.Conn
+	for i := 0; i < 50 && conn == nil; i++ {
+		conn, _ = net.Dial("tcp", addr)
+		time.Sleep(10 * time.Millisecond)
+	}
+	if conn == nil {
+		t.Fatal("server did not start")
+	}
+	defer conn.Close()
+
+	// the request is in progress until the headers are finished
+	must(conn.Write([]byte("GET /healthz HTTP/1.1\r\nHost: localhost\r\n")))
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the shutdown to report the cut off connection, got: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown did not finish within the timeout")
+	}
+}
+
+func Test_StaticAssets(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	page := string(mustT[[]byte](t)(io.ReadAll(mustT[*http.Response](t)(http.Get(srv.URL + "/login")).Body)))
+	_, rest, _ := strings.Cut(page, `<link rel="stylesheet" href="/static/index.`)
+	css, _, _ := strings.Cut("/static/index."+rest, `"`)
+	if !strings.HasPrefix(css, "/static/index.") || css == "/static/index.css" {
+		t.Fatalf("expected fingerprinted stylesheet, got: %s", css)
+	}
+
+	get := func(path, encoding, etag string) *http.Response {
+		t.Helper()
+		req := mustT[*http.Request](t)(http.NewRequest(http.MethodGet, srv.URL+path, nil))
+		// set explicitly, so the transport does not decompress the body
+		req.Header.Set("Accept-Encoding", encoding)
+		if len(etag) != 0 {
+			req.Header.Set("If-None-Match", etag)
+		}
+		return mustT[*http.Response](t)(http.DefaultClient.Do(req))
+	}
+
+	for name, tc := range map[string]struct {
+		path, encoding, cache string
+	}{
+		"brotli":     {path: css, encoding: "gzip, br", cache: "immutable"},
+		"gzip":       {path: css, encoding: "gzip", cache: "immutable"},
+		"identity":   {path: css, encoding: "identity", cache: "immutable"},
+		"plain name": {path: "/static/index.css", encoding: "br", cache: "no-cache"},
+		"script":     {path: "/static/index.js", encoding: "gzip", cache: "no-cache"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := get(tc.path, tc.encoding, "")
+			expected := tc.encoding
+			if i := strings.LastIndex(expected, " "); i >= 0 {
+				expected = expected[i+1:]
+			}
+
+			if enc := resp.Header.Get("Content-Encoding"); enc != strings.TrimPrefix(expected, "identity") {
+				t.Errorf("expected encoding: %s, got: %q", expected, enc)
+			}
+
+			if cc := resp.Header.Get("Cache-Control"); !strings.Contains(cc, tc.cache) {
+				t.Errorf("expected cache control: %s, got: %s", tc.cache, cc)
+			}
+
+			etag := resp.Header.Get("ETag")
+			if resp = get(tc.path, tc.encoding, etag); resp.StatusCode != http.StatusNotModified {
+				t.Errorf("expected not modified with etag: %s, status: %d", etag, resp.StatusCode)
+			}
+		})
+	}
+
+	if resp := get("/static/missing.css", "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected missing asset not to be found, status: %d", resp.StatusCode)
+	}
+}
+
+func Test_SecurityHeaders(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	for name, path := range map[string]string{
+		"page":      "/login",
+		"asset":     "/static/index.css",
+		"not found": "/static/missing.css",
+		"api":       "/api/todos",
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := mustT[*http.Response](t)(http.Get(srv.URL + path))
+			csp := resp.Header.Get("Content-Security-Policy")
+			for _, directive := range []string{"default-src 'none'", "script-src 'self'", "style-src 'self'", "frame-ancestors 'none'"} {
+				if !strings.Contains(csp, directive) {
+					t.Errorf("expected content security policy with: %s, got: %s", directive, csp)
+				}
+			}
+
+			if v := resp.Header.Get("X-Content-Type-Options"); v != "nosniff" {
+				t.Errorf("expected nosniff, got: %q", v)
+			}
+
+			if v := resp.Header.Get("X-Frame-Options"); v != "DENY" {
+				t.Errorf("expected framing to be denied, got: %q", v)
+			}
+
+			if v := resp.Header.Get("Strict-Transport-Security"); len(v) != 0 {
+				t.Errorf("expected no HSTS over plain HTTP, got: %q", v)
+			}
+		})
+	}
+}
+
+func Test_Events(t *testing.T) {
+	// the streams and their subscriptions must be gone once the server is closed
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(&server.HttpCfg{Address: "127.0.0.1:0", Heartbeat: 10 * time.Millisecond}, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	alice := newBrowser(t, srv)
+	defer alice.CloseIdleConnections()
+	must(alice.PostForm(srv.URL+"/signup", url.Values{"name": {"alice"}, "password": {"correct horse"}})).Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var streams []*http.Response
+	stream := func(path, lastID string) *http.Response {
+		t.Helper()
+		req := mustT[*http.Request](t)(http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil))
+		if len(lastID) != 0 {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp := mustT[*http.Response](t)(alice.Do(req))
+		streams = append(streams, resp)
+		return resp
+	}
+
+	resp := mustT[*http.Response](t)(alice.Get(srv.URL + "/?show=active"))
+	if page := string(mustT[[]byte](t)(io.ReadAll(resp.Body))); !strings.Contains(page, `data-list="default-`) || !strings.Contains(page, `data-done="false">`) {
+		t.Errorf("expected the page to tell the list and the tab of the streamed tasks, got: %s", page)
+	}
+	resp.Body.Close()
+
+	ui := stream("/events", "")
+	if ct := ui.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got: %s", ct)
+	}
+	uiEvents := bufio.NewReader(ui.Body)
+
+	must(alice.PostForm(srv.URL+"/api/todos", url.Values{"todo": {"live"}})).Body.Close()
+	created, _ := readEvent(t, uiEvents)
+	if created.event != "created" || !strings.Contains(created.data, `id="item-`) || !strings.Contains(created.data, "live") {
+		t.Errorf("expected fragment of the created task, got: %+v", created)
+	}
+
+	tasks := decode[[]todo.Task](t, mustT[*http.Response](t)(alice.Get(srv.URL+"/api/todos")))
+	time.Sleep(50 * time.Millisecond)
+	req := mustT[*http.Request](t)(http.NewRequest(http.MethodPut, srv.URL+"/api/todos/"+string(tasks[0].ID)+"/toggle", nil))
+	must(alice.Do(req)).Body.Close()
+
+	toggled, heartbeats := readEvent(t, uiEvents)
+	// the page drops the task from the tab of the active ones, see showItem of index.js
+	if toggled.event != "toggled" || !strings.Contains(toggled.data, `checked="checked"`) || !strings.Contains(toggled.data, `data-done="true"`) {
+		t.Errorf("expected fragment of the toggled task, got: %+v", toggled)
+	}
+
+	if heartbeats == 0 {
+		t.Errorf("expected heartbeats of the idle stream")
+	}
+
+	replayed, _ := readEvent(t, bufio.NewReader(stream("/api/events", created.id).Body))
+	var e todo.Event
+	if err := json.Unmarshal([]byte(replayed.data), &e); err != nil || e.Kind != todo.TaskToggled || !e.Task.Done {
+		t.Errorf("expected replay of the toggled task after: %s, got: %+v, %v", created.id, replayed, err)
+	}
+
+	if missed, _ := readEvent(t, bufio.NewReader(stream("/api/events", "1").Body)); missed.event != "reload" {
+		t.Errorf("expected reload after missed events, got: %+v", missed)
+	}
+
+	if resp := stream("/api/events", "not a number"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected invalid Last-Event-ID to be rejected, status: %d", resp.StatusCode)
+	}
+
+	stopCtx, stop := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- api.Start(stopCtx) }()
+	stop()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// reading fails with the deadline of the context, if the stream is not closed by the shutdown
+	for _, resp := range streams {
+		if _, err := io.ReadAll(resp.Body); err != nil {
+			t.Errorf("expected the stream: %s to end on shutdown, got: %v", resp.Request.URL, err)
+		}
+		resp.Body.Close()
+	}
+}
+
+func Test_History(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	alice, bob := newBrowser(t, srv), newBrowser(t, srv)
+	for name, c := range map[string]*http.Client{"alice": alice, "bob": bob} {
+		must(c.PostForm(srv.URL+"/signup", url.Values{"name": {name}, "password": {"correct horse"}})).Body.Close()
+	}
+
+	do := func(method, path, body string) {
+		t.Helper()
+		req := mustT[*http.Request](t)(http.NewRequest(method, srv.URL+path, strings.NewReader(body)))
+		req.Header.Set("Content-Type", "application/json")
+		resp := mustT[*http.Response](t)(alice.Do(req))
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			t.Fatalf("%s %s failed with status: %d", method, path, resp.StatusCode)
+		}
+	}
+
+	do(http.MethodPost, "/api/todos", `{"title": "milk"}`)
+	id := string(decode[[]todo.Task](t, mustT[*http.Response](t)(alice.Get(srv.URL+"/api/todos")))[0].ID)
+	do(http.MethodPut, "/api/todos/"+id+"/toggle", "")
+	do(http.MethodPatch, "/api/todos/"+id, `{"title": "oat milk", "deadline": "2024-03-01T12:00:00Z"}`)
+	do(http.MethodDelete, "/api/todos/"+id, "")
+
+	changes := decode[[]todo.Change](t, mustT[*http.Response](t)(alice.Get(srv.URL+"/api/todos/"+id+"/history")))
+	expected := []todo.ChangeKind{todo.ChangeCreated, todo.ChangeToggled, todo.ChangeRenamed, todo.ChangeDeadlineChanged, todo.ChangeDeleted}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected changes: %v, got: %+v", expected, changes)
+	}
+
+	for i, c := range changes {
+		if c.Kind != expected[i] || c.Actor != "alice" {
+			t.Errorf("expected change: %s by alice, got: %+v", expected[i], c)
+		}
+	}
+
+	if resp := mustT[*http.Response](t)(bob.Get(srv.URL + "/api/todos/" + id + "/history")); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the history of other user's task not to be found, status: %d", resp.StatusCode)
+	}
+
+	resp := mustT[*http.Response](t)(alice.Get(srv.URL + "/todos/" + id + "/history"))
+	panel := string(mustT[[]byte](t)(io.ReadAll(resp.Body)))
+	for _, text := range []string{`id="history-` + id + `"`, "marked as done", "renamed to &#34;oat milk&#34;", "set the deadline to 2024-03-01 12:00", "deleted"} {
+		if !strings.Contains(panel, text) {
+			t.Errorf("expected the panel to contain: %s, got: %s", text, panel)
+		}
+	}
+}
+
+// sseEvent is a single event read from the stream of Server-Sent Events
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvent reads the stream up to the next event, the comments are skipped and counted.
+func readEvent(t *testing.T, r *bufio.Reader) (e sseEvent, comments int) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the event stream: %v", err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "":
+			if len(line) == 0 && len(e.event) != 0 {
+				return e, comments
+			}
+			comments++
+		case "id":
+			e.id = value
+		case "event":
+			e.event = value
+		case "data":
+			e.data += value + "\n"
+		}
+	}
+}
+
+// scripts use the API with tokens instead of sessions
+func Test_Tokens(t *testing.T) {
+	s := memory.NewTaskStorage()
+	api := must(server.NewHttp(nil, todo.NewHandler(s, s, s)))
+	srv := httptest.NewServer(api.Handler())
+	defer srv.Close()
+
+	browser := newBrowser(t, srv)
+	must(browser.PostForm(srv.URL+"/signup", url.Values{"name": {"alice"}, "password": {"correct horse"}}))
+
+	create := func(scope todo.Scope) (todo.TokenID, string) {
+		body := `{"name":"script","scope":"` + string(scope) + `"}`
+		resp := mustT[*http.Response](t)(browser.Post(srv.URL+"/api/tokens", "application/json", strings.NewReader(body)))
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("creating %s token, status: %d", scope, resp.StatusCode)
+		}
+
+		created := decode[struct {
+			ID     todo.TokenID `json:"id"`
+			Secret string       `json:"secret"`
+		}](t, resp)
+		return created.ID, created.Secret
+	}
+
+	_, read := create(todo.ScopeRead)
+	writeID, write := create(todo.ScopeWrite)
+
+	script := &http.Client{Transport: newLoggingTransport(t)}
+	do := func(token, method, path, body string) *http.Response {
+		req := mustT[*http.Request](t)(http.NewRequest(method, srv.URL+path, strings.NewReader(body)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		return mustT[*http.Response](t)(script.Do(req))
+	}
+
+	tt := map[string]struct {
+		token, method, path, body string
+		status                    int
+		challenge                 string
+	}{
+		"read token lists tasks": {
+			token: read, method: http.MethodGet, path: "/api/todos", status: http.StatusOK,
+		},
+		"read token can not create tasks": {
+			token: read, method: http.MethodPost, path: "/api/todos", body: `{"title":"nope"}`,
+			status: http.StatusForbidden, challenge: `Bearer realm="todos", error="insufficient_scope"`,
+		},
+		"write token creates tasks": {
+			token: write, method: http.MethodPost, path: "/api/todos", body: `{"title":"from script"}`, status: http.StatusCreated,
+		},
+		"unknown token": {
+			token: "todo_unknown", method: http.MethodGet, path: "/api/todos",
+			status: http.StatusUnauthorized, challenge: `Bearer realm="todos", error="invalid_token"`,
+		},
+		"tokens can not manage tokens": {
+			token: write, method: http.MethodGet, path: "/api/tokens",
+			status: http.StatusForbidden, challenge: `Bearer realm="todos", error="insufficient_scope"`,
+		},
+	}
+
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			resp := do(tc.token, tc.method, tc.path, tc.body)
+			if resp.StatusCode != tc.status {
+				t.Errorf("expected status: %d, actual: %d", tc.status, resp.StatusCode)
+			}
+
+			if challenge := resp.Header.Get("WWW-Authenticate"); challenge != tc.challenge {
+				t.Errorf("expected challenge: %q, actual: %q", tc.challenge, challenge)
+			}
+		})
+	}
+
+	resp := mustT[*http.Response](t)(browser.Get(srv.URL + "/api/todos"))
+	if tasks := decode[[]todo.Task](t, resp); len(tasks) != 1 || tasks[0].Title != "from script" {
+		t.Errorf("expected the task created by the script to belong to the user, got: %+v", tasks)
+	}
+
+	req := mustT[*http.Request](t)(http.NewRequest(http.MethodDelete, srv.URL+"/api/tokens/"+string(writeID), nil))
+	if resp = mustT[*http.Response](t)(browser.Do(req)); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("revoking the token, status: %d", resp.StatusCode)
+	}
+
+	if resp = do(write, http.MethodGet, "/api/todos", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected revoked token to be rejected, status: %d", resp.StatusCode)
+	}
+
+	resp = mustT[*http.Response](t)(browser.Get(srv.URL + "/api/tokens"))
+	if tokens := decode[[]todo.Token](t, resp); len(tokens) != 1 || tokens[0].Scope != todo.ScopeRead {
+		t.Errorf("expected just the read token to be left, got: %+v", tokens)
+	}
+
+	resp = mustT[*http.Response](t)(browser.Get(srv.URL + "/tokens"))
+	if page := string(mustT[[]byte](t)(io.ReadAll(resp.Body))); resp.StatusCode != http.StatusOK || !strings.Contains(page, "script") {
+		t.Errorf("expected the page to list the token, status: %d", resp.StatusCode)
+	}
+}
+
+// JSON clients should get resources instead of redirects
+func Test_APIHandler_JSON(t *testing.T) {
+	s := memory.NewTaskStorage()
+	h := todo.NewHandler(s, s, s)
+	api := must(server.NewHttp(nil, h))
+
+	srv := httptest.NewServer(api.APIHandler())
+	defer srv.Close()
+	client := srv.Client()
+	client.Transport = newLoggingTransport(t)
+
+	resp, err := client.Post(srv.URL+"/todos", "application/json", strings.NewReader(`{"title":"test-todo-1","deadline":"2024-03-20T18:00:00+01:00"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status: %d, actual: %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	created := decode[todo.Task](t, resp)
+	if created.Title != "test-todo-1" || created.Done || created.Deadline == nil {
+		t.Errorf("unexpected created task: %+v", created)
+	}
+
+	loc := resp.Header.Get("Location")
+	if loc != "/api/todos/"+string(created.ID) {
+		t.Errorf("unexpected location: %s", loc)
+	}
+
+	resp = mustT[*http.Response](t)(client.Get(srv.URL + "/todos/" + string(created.ID)))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status: %d, actual: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if got := decode[todo.Task](t, resp); got.ID != created.ID {
+		t.Errorf("expected task: %s, got: %s", created.ID, got.ID)
+	}
+
+	if tag := resp.Header.Get("ETag"); tag != `"1"` {
+		t.Errorf("unexpected ETag of a new task: %s", tag)
+	}
+
+	req := mustT[*http.Request](t)(http.NewRequest(http.MethodPatch, srv.URL+"/todos/"+string(created.ID), strings.NewReader(`{"done":true,"deadline":null}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	resp = mustT[*http.Response](t)(client.Do(req))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status: %d, actual: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if patched := decode[todo.Task](t, resp); !patched.Done || patched.Deadline != nil || patched.Title != created.Title {
+		t.Errorf("unexpected patched task: %+v", patched)
+	}
+
+	req = mustT[*http.Request](t)(http.NewRequest(http.MethodPatch, srv.URL+"/todos/"+string(created.ID), strings.NewReader(`{"title":"lost update"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	resp = mustT[*http.Response](t)(client.Do(req))
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("stale write should be rejected, expected status: %d, actual: %d", http.StatusPreconditionFailed, resp.StatusCode)
+	}
+
+	// toggle and delete are conditional too, the task is in version 2 after the patch
+	conditional := func(method, path, etag string) *http.Response {
+		req := mustT[*http.Request](t)(http.NewRequest(method, srv.URL+"/todos/"+string(created.ID)+path, nil))
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("If-Match", etag)
+		resp := mustT[*http.Response](t)(client.Do(req))
+		_ = resp.Body.Close()
+		return resp
+	}
+
+	for name, tc := range map[string]struct {
+		method, path, etag string
+		expected           int
+	}{
+		"stale toggle":        {method: http.MethodPut, path: "/toggle", etag: `"1"`, expected: http.StatusPreconditionFailed},
+		"stale delete":        {method: http.MethodDelete, etag: `"1", "3"`, expected: http.StatusPreconditionFailed},
+		"weak delete":         {method: http.MethodDelete, etag: `W/"2"`, expected: http.StatusPreconditionFailed},
+		"missing task toggle": {method: http.MethodPut, path: "x/toggle", etag: `"1"`, expected: http.StatusNotFound},
+	} {
+		if resp = conditional(tc.method, tc.path, tc.etag); resp.StatusCode != tc.expected {
+			t.Errorf("%s, expected status: %d, actual: %d", name, tc.expected, resp.StatusCode)
+		}
+	}
+
+	if resp = conditional(http.MethodPut, "/toggle", `"2"`); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"3"` {
+		t.Errorf("current toggle, expected status: %d with ETag: \"3\", actual: %d with: %s", http.StatusOK, resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	req = mustT[*http.Request](t)(http.NewRequest(http.MethodPatch, srv.URL+"/todos/"+string(created.ID), strings.NewReader(`{"title":"  "}`)))
+	req.Header.Set("Content-Type", "application/json")
+	resp = mustT[*http.Response](t)(client.Do(req))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("blank title should be rejected, expected status: %d, actual: %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp = mustT[*http.Response](t)(client.Get(srv.URL + "/todos"))
+	if all := decode[[]todo.Task](t, resp); len(all) != 1 {
+		t.Errorf("expected one task, got: %d", len(all))
+	}
+
+	resp = mustT[*http.Response](t)(client.Get(srv.URL + "/todos/missing"))
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status: %d, actual: %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	del := func() *http.Response {
+		req := mustT[*http.Request](t)(http.NewRequest(http.MethodDelete, srv.URL+"/todos/"+string(created.ID), nil))
+		return mustT[*http.Response](t)(client.Do(req))
+	}
+
+	if resp = del(); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status: %d, actual: %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	if resp = del(); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status: %d, actual: %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+// racingStorage writes the task concurrently, right before the next write of the handler
+type racingStorage struct {
+	*memory.TaskStorage
+	race atomic.Bool
+}
+
+func (s *racingStorage) Upsert(ctx context.Context, t todo.Task) (todo.Task, error) {
+	if s.race.CompareAndSwap(true, false) {
+		concurrent := t
+		concurrent.Title = "concurrent"
+		if _, err := s.TaskStorage.Upsert(ctx, concurrent); err != nil {
+			return todo.Task{}, err
+		}
+	}
+
+	return s.TaskStorage.Upsert(ctx, t)
+}
+
+// without If-Match the patch is applied to whatever version is current, so a concurrent write does not fail it
+func Test_APIHandler_PatchConcurrentWrite(t *testing.T) {
+	s := &racingStorage{TaskStorage: memory.NewTaskStorage()}
+	h := todo.NewHandler(s, s, s)
+	srv := httptest.NewServer(must(server.NewHttp(nil, h)).APIHandler())
+	defer srv.Close()
+	client := srv.Client()
+	client.Transport = newLoggingTransport(t)
+
+	created := must(h.Create(context.Background(), todo.CreateTask{Title: "milk"}))
+	patch := func(etag string) *http.Response {
+		req := mustT[*http.Request](t)(http.NewRequest(http.MethodPatch, srv.URL+"/todos/"+string(created.ID), strings.NewReader(`{"done":true}`)))
+		req.Header.Set("Content-Type", "application/json")
+		if len(etag) != 0 {
+			req.Header.Set("If-Match", etag)
+		}
+		s.race.Store(true)
+		return mustT[*http.Response](t)(client.Do(req))
+	}
+
+	resp := patch("")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status: %d, actual: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	patched := decode[todo.Task](t, resp)
+	if !patched.Done || patched.Title != "concurrent" {
+		t.Errorf("expected the patch to be applied to the concurrent write, got: %+v", patched)
+	}
+
+	if resp = patch(fmt.Sprintf(`"%d"`, patched.Version)); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected status: %d, actual: %d", http.StatusPreconditionFailed, resp.StatusCode)
+	}
+}
+
+func decode[T any](t *testing.T, resp *http.Response) T {
+	t.Helper()
+	defer resp.Body.Close()
+
+	var v T
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		t.Fatalf("decoding the response body, %v", err)
+	}
+
+	return v
+}
+
 func mustT[T any](t *testing.T) func(value T, err error) T {
 	return func(value T, err error) T {
 		if err != nil {
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"todo/internal/logging"
+	"todo/internal/todo"
+)
+
+// createListRequest is a JSON body of POST /api/lists
+type createListRequest struct {
+	Name string `json:"name"`
+}
+
+// patchListRequest is a JSON body of PATCH /api/lists/{id}.
+// Fields which are not present in the body are left untouched.
+type patchListRequest struct {
+	Name     *string `json:"name"`
+	Archived *bool   `json:"archived"`
+}
+
+// HandleGetLists lists the lists ordered by name. Archived ones are included with archived=true query parameter.
+func (h *Http) HandleGetLists(w http.ResponseWriter, r *http.Request) {
+	archived := false
+	if v := r.URL.Query().Get("archived"); len(v) != 0 {
+		var err error
+		archived, err = strconv.ParseBool(v)
+		if err != nil {
+			slog.InfoContext(r.Context(), "parsing archived", logging.Err(err))
+			jsonErr(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	lists, err := h.h.Lists(r.Context(), archived)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing the lists", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, lists)
+}
+
+func (h *Http) HandleGetList(w http.ResponseWriter, r *http.Request) {
+	list, err := h.h.GetList(r.Context(), todo.ListID(r.PathValue("id")))
+	if errors.Is(err, todo.ErrListNotFound) {
+		jsonErr(w, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "getting the list", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// HandlePostList accepts either a JSON body or a form submitted from the index page, which is redirected to the new list.
+func (h *Http) HandlePostList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	isJSON := hasJSONBody(r)
+	fail := httpErr
+	if isJSON {
+		fail = jsonErr
+	}
+
+	req := createListRequest{}
+	if isJSON {
+		err := decodeJSON(r, &req)
+		if err != nil {
+			slog.InfoContext(ctx, "decoding the list", logging.Err(err))
+			fail(w, readErr(err))
+			return
+		}
+	} else {
+		err := r.ParseForm()
+		if err != nil {
+			slog.ErrorContext(ctx, "parsing the form", logging.Err(err))
+			fail(w, readErr(err))
+			return
+		}
+		req.Name = r.Form.Get("name")
+	}
+
+	stored, err := h.h.CreateList(ctx, todo.CreateList{Name: req.Name})
+	if errors.Is(err, todo.ErrInvalidList) {
+		slog.InfoContext(ctx, "invalid list", logging.Err(err))
+		fail(w, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "creating the list", logging.Err(err))
+		fail(w, http.StatusInternalServerError)
+		return
+	}
+
+	if !isJSON {
+		http.Redirect(w, r, listPath(stored.ID), http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("Location", apiPrefix+"/lists/"+string(stored.ID))
+	writeJSON(w, http.StatusCreated, stored)
+}
+
+// HandlePatchList renames, archives or restores the list.
+func (h *Http) HandlePatchList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	req := patchListRequest{}
+	err := decodeJSON(r, &req)
+	if err != nil {
+		slog.InfoContext(ctx, "decoding the patch", logging.Err(err))
+		jsonErr(w, readErr(err))
+		return
+	}
+
+	id := todo.ListID(r.PathValue("id"))
+	list, err := h.h.UpdateList(ctx, id, todo.UpdateList{Name: req.Name, Archived: req.Archived})
+
+	if errors.Is(err, todo.ErrListNotFound) {
+		jsonErr(w, http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, todo.ErrInvalidList) {
+		slog.InfoContext(ctx, "invalid list", logging.Err(err))
+		jsonErr(w, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "updating the list", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
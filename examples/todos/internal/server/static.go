@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+//go:embed static
+var staticFS embed.FS
+
+// assetsPrefix is the path the assets are served at, see StaticHandler
+const assetsPrefix = "/static/"
+
+// asset is kept in memory with its compressed variants, which are compressed only once on startup.
+type asset struct {
+	contentType string
+	// hash of the content is both in the fingerprinted name and in the ETag
+	hash string
+	// variants by Content-Encoding, identity is always present
+	variants map[string][]byte
+}
+
+// encodings are preferred in the order, if the client accepts them
+var encodings = []string{"br", "gzip"}
+
+// assets are served under both the plain and the fingerprinted name, e.g. index.js and index.0123456789.js.
+// Templates link the fingerprinted names, see URL, which change with the content, so they can be cached forever.
+type assets struct {
+	// byName maps both names to the asset
+	byName map[string]*asset
+	// fingerprinted maps the plain name to the fingerprinted one
+	fingerprinted map[string]string
+}
+
+// newAssets reads all the files of fsys.
+func newAssets(fsys fs.FS) (*assets, error) {
+	a := &assets{byName: make(map[string]*asset), fingerprinted: make(map[string]string)}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("reading asset: %s, %w", name, err)
+		}
+
+		as, err := newAsset(name, content)
+		if err != nil {
+			return err
+		}
+
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + as.hash + ext
+		a.byName[name] = as
+		a.byName[hashed] = as
+		a.fingerprinted[name] = hashed
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading the assets, %w", err)
+	}
+
+	return a, nil
+}
+
+func newAsset(name string, content []byte) (*asset, error) {
+	sum := sha256.Sum256(content)
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if len(contentType) == 0 {
+		contentType = http.DetectContentType(content)
+	}
+
+	as := &asset{
+		contentType: contentType,
+		hash:        hex.EncodeToString(sum[:5]),
+		variants:    map[string][]byte{"identity": content},
+	}
+
+	for _, enc := range encodings {
+		compressed, err := compress(enc, content)
+		if err != nil {
+			return nil, fmt.Errorf("compressing asset: %s with: %s, %w", name, enc, err)
+		}
+
+		// tiny files may grow when compressed
+		if len(compressed) < len(content) {
+			as.variants[enc] = compressed
+		}
+	}
+
+	return as, nil
+}
+
+func compress(encoding string, content []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+
+	switch encoding {
+	case "br":
+		w = brotli.NewWriterLevel(buf, brotli.BestCompression)
+	case "gzip":
+		w, _ = gzip.NewWriterLevel(buf, gzip.BestCompression)
+	default:
+		return nil, fmt.Errorf("unknown encoding: %s", encoding)
+	}
+
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// URL returns the fingerprinted path of the asset, it is available in the templates as: {{ asset "index.js" }}.
+// Names of unknown assets are returned as they are, so a typo results in 404 instead of a broken page.
+func (a *assets) URL(name string) string {
+	if hashed, ok := a.fingerprinted[name]; ok {
+		return assetsPrefix + hashed
+	}
+
+	return assetsPrefix + name
+}
+
+// ServeHTTP serves the asset in the best encoding accepted by the client. Fingerprinted names are cached forever,
+// plain names are revalidated with the ETag, which differs for every encoding.
+func (a *assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	as, ok := a.byName[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	encoding, body := "identity", as.variants["identity"]
+	for _, enc := range encodings {
+		if v, ok := as.variants[enc]; ok && acceptsEncoding(r.Header.Get("Accept-Encoding"), enc) {
+			encoding, body = enc, v
+			break
+		}
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", as.contentType)
+	h.Set("Vary", "Accept-Encoding")
+	if encoding == "identity" {
+		h.Set("ETag", `"`+as.hash+`"`)
+	} else {
+		h.Set("Content-Encoding", encoding)
+		h.Set("ETag", `"`+as.hash+"-"+encoding+`"`)
+	}
+
+	if _, plain := a.fingerprinted[name]; plain {
+		h.Set("Cache-Control", "no-cache")
+	} else {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+
+	// handles If-None-Match with the ETag and the ranges
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(body))
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header allows the encoding, i.e. it is listed, possibly as *, without q=0.
+func acceptsEncoding(header, encoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(header, ",") {
+		token, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		token = strings.TrimSpace(token)
+		if token != encoding && token != "*" {
+			continue
+		}
+
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = parsed
+			}
+		}
+
+		// the exact token takes precedence over *
+		if token == encoding {
+			return q > 0
+		}
+		accepted = q > 0
+	}
+
+	return accepted
+}
@@ -0,0 +1,291 @@
+// csrfToken is rendered by the server in the page, it must be sent along with every request changing the state
+function csrfToken() {
+    var meta = document.querySelector("meta[name=csrf-token]");
+    return meta ? meta.content : "";
+}
+
+// showItem swaps the rendered task for the fragment sent by the server, so the page shows the stored state.
+// The task is kept at its place in the order of the page, or removed when it does not belong to the page anymore,
+// e.g. it was toggled in another tab, and a task which is not rendered yet is added, if it belongs to the page.
+function showItem(html) {
+    var template = document.createElement("template");
+    template.innerHTML = html.trim();
+    var item = template.content.firstElementChild;
+    var id = item.id.replace("item-", "");
+    var current = document.getElementById(item.id);
+    if (!shownOnPage(item)) {
+        removeItem(id);
+        return;
+    }
+
+    if (current) {
+        current.remove();
+    }
+    insertSorted(item);
+
+    // the open history misses the change and it follows the moved task, so it is loaded again
+    var history = document.getElementById("history-" + id);
+    if (history) {
+        history.remove();
+        taskHistory(id);
+    }
+}
+
+// shownOnPage reports whether the task belongs to the list and the tab of the page
+function shownOnPage(item) {
+    var page = document.body.dataset;
+    return item.dataset.list === page.list && (!page.done || item.dataset.done === page.done);
+}
+
+// insertSorted adds the task before the first one following it in the order of the server:
+// by the deadline with the tasks without it last, then by the id
+function insertSorted(item) {
+    var items = document.getElementById("items");
+    var next = Array.prototype.find.call(items.querySelectorAll("[id^=item-]"), function (other) {
+        return compareItems(item, other) < 0;
+    });
+    if (next) {
+        next.before(item);
+    } else {
+        items.append(item);
+    }
+}
+
+function compareItems(a, b) {
+    var da = a.dataset.deadline ? Number(a.dataset.deadline) : Infinity;
+    var db = b.dataset.deadline ? Number(b.dataset.deadline) : Infinity;
+    if (da !== db) {
+        return da < db ? -1 : 1;
+    }
+    return a.id < b.id ? -1 : a.id > b.id ? 1 : 0;
+}
+
+// removeItem removes the task, unless the event of its deletion removed it already
+function removeItem(id) {
+    ["item-", "history-"].forEach(function (prefix) {
+        var el = document.getElementById(prefix + id);
+        if (el) {
+            el.remove();
+        }
+    });
+}
+
+// taskHistory shows the panel with the changes of the task below it, or hides the panel when it is shown
+function taskHistory(id) {
+    var shown = document.getElementById("history-" + id);
+    if (shown) {
+        shown.remove();
+        return;
+    }
+
+    var xhr = new XMLHttpRequest();
+    xhr.open("GET", "/todos/" + id + "/history", true);
+    xhr.onload = function () {
+        if (xhr.status === 200) {
+            document.getElementById("item-" + id).insertAdjacentHTML("afterend", xhr.responseText);
+        }
+    };
+    xhr.send();
+}
+
+// listenForChanges keeps the page up to date with the changes made in the other tabs or by the API clients.
+// The browser reconnects on its own, sending the id of the last event, so the server replays the missed ones.
+function listenForChanges() {
+    var events = new EventSource("/events");
+    ["created", "updated", "toggled"].forEach(function (kind) {
+        events.addEventListener(kind, function (event) {
+            showItem(event.data);
+        });
+    });
+    events.addEventListener("deleted", function (event) {
+        removeItem(event.data);
+    });
+    events.addEventListener("reload", function () {
+        window.location.reload();
+    });
+}
+
+function taskCreated(form) {
+    var xhr = new XMLHttpRequest();
+    xhr.open("POST", form.action, true);
+    xhr.setRequestHeader("X-CSRF-Token", csrfToken());
+    // asks for the fragment of the created task instead of the redirect to the whole page
+    xhr.setRequestHeader("X-Requested-With", "XMLHttpRequest");
+    xhr.onload = function () {
+        if (xhr.status === 400) {
+            alert("The task can not be created like that.");
+        }
+        if (xhr.status === 201) {
+            showItem(xhr.responseText);
+            form.elements.todo.value = "";
+            form.elements.deadline.value = "";
+        }
+    };
+    xhr.send(new URLSearchParams(new FormData(form)));
+}
+
+function taskToggled(id) {
+    var xhr = new XMLHttpRequest();
+    xhr.open("PUT", "/api/todos/" + id + "/toggle", true);
+    xhr.setRequestHeader("X-CSRF-Token", csrfToken());
+    xhr.setRequestHeader("X-Requested-With", "XMLHttpRequest");
+    xhr.onload = function () {
+        if (xhr.status === 200) {
+            showItem(xhr.responseText);
+        } else {
+            // the checkbox is already flipped, only the server knows the state
+            window.location.reload();
+        }
+    };
+    xhr.send();
+}
+
+function taskDeleted(id) {
+    var xhr = new XMLHttpRequest();
+    xhr.open("DELETE", "/api/todos/" + id, true);
+    xhr.setRequestHeader("X-CSRF-Token", csrfToken());
+    xhr.onload = function () {
+        if (xhr.status === 204 || xhr.status === 404) {
+            removeItem(id);
+        }
+    };
+    xhr.send();
+}
+
+function taskEditing(id) {
+    var form = document.getElementById("edit-" + id);
+    var label = document.querySelector("label[for='" + id + "']");
+    if (form.dataset.deadline) {
+        // datetime-local expects the local time without the zone
+        var d = new Date(form.dataset.deadline);
+        d.setMinutes(d.getMinutes() - d.getTimezoneOffset());
+        form.elements.deadline.value = d.toISOString().slice(0, 16);
+    }
+    label.classList.add("hidden");
+    form.classList.replace("hidden", "flex");
+    form.elements.title.focus();
+}
+
+function taskEdited(form, id) {
+    var deadline = form.elements.deadline.value;
+    var xhr = new XMLHttpRequest();
+    xhr.open("PATCH", "/api/todos/" + id, true);
+    xhr.setRequestHeader("X-CSRF-Token", csrfToken());
+    xhr.setRequestHeader("Content-Type", "application/json");
+    xhr.setRequestHeader("Accept", "text/html");
+    xhr.setRequestHeader("X-Requested-With", "XMLHttpRequest");
+    xhr.setRequestHeader("If-Match", '"' + form.dataset.version + '"');
+    xhr.onload = function () {
+        if (xhr.status === 412) {
+            alert("The task was changed in the meantime, the page will be reloaded.");
+            window.location.reload();
+        }
+        if (xhr.status === 200) {
+            showItem(xhr.responseText);
+        }
+    };
+    xhr.send(JSON.stringify({
+        title: form.elements.title.value,
+        // the browser knows the user's time zone, so it converts the local time to an absolute one
+        deadline: deadline ? new Date(deadline).toISOString() : null
+    }));
+}
+
+function listRenamed(id, current) {
+    var name = prompt("Name of the list", current);
+    if (!name || name === current) {
+        return;
+    }
+    listPatched(id, {name: name});
+}
+
+function listArchived(id, archived) {
+    listPatched(id, {archived: archived});
+}
+
+function listPatched(id, patch) {
+    var xhr = new XMLHttpRequest();
+    xhr.open("PATCH", "/api/lists/" + id, true);
+    xhr.setRequestHeader("X-CSRF-Token", csrfToken());
+    xhr.setRequestHeader("Content-Type", "application/json");
+    xhr.onload = function () {
+        if (xhr.status === 400) {
+            alert("The list can not be changed like that.");
+        }
+        if (xhr.status === 200) {
+            window.location.reload();
+        }
+    };
+    xhr.send(JSON.stringify(patch));
+}
+
+function tokenRevoked(id) {
+    var xhr = new XMLHttpRequest();
+    xhr.open("DELETE", "/api/tokens/" + id, true);
+    xhr.setRequestHeader("X-CSRF-Token", csrfToken());
+    xhr.onload = function () {
+        if (xhr.status === 204 || xhr.status === 404) {
+            document.getElementById("token-" + id).remove();
+        }
+    };
+    xhr.send();
+}
+
+// the content security policy forbids inline handlers, so the elements name their action in data-action instead
+document.addEventListener("click", function (event) {
+    var el = event.target.closest("[data-action]");
+    if (!el) {
+        return;
+    }
+
+    var id = el.dataset.id;
+    switch (el.dataset.action) {
+        case "task-toggle":
+            taskToggled(id);
+            break;
+        case "task-editing":
+            taskEditing(id);
+            break;
+        case "task-delete":
+            taskDeleted(id);
+            break;
+        case "task-history":
+            taskHistory(id);
+            break;
+        case "list-rename":
+            listRenamed(id, el.dataset.title);
+            break;
+        case "list-archive":
+            listArchived(id, el.dataset.archived === "true");
+            break;
+        case "token-revoke":
+            tokenRevoked(id);
+            break;
+    }
+});
+
+document.addEventListener("submit", function (event) {
+    var form = event.target;
+    switch (form.dataset.action) {
+        case "task-create":
+            event.preventDefault();
+            taskCreated(form);
+            break;
+        case "task-edit":
+            event.preventDefault();
+            taskEdited(form, form.dataset.id);
+            break;
+    }
+});
+
+// deadlines are entered in the local time, so the server needs to know the user's time zone
+document.addEventListener("DOMContentLoaded", function () {
+    var tz = Intl.DateTimeFormat().resolvedOptions().timeZone;
+    document.querySelectorAll("input[name=tz]").forEach(function (input) {
+        input.value = tz;
+    });
+
+    if (document.body.dataset.list) {
+        listenForChanges();
+    }
+});
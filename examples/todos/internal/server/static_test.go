@@ -0,0 +1,29 @@
+package server
+
+import "testing"
+
+func Test_acceptsEncoding(t *testing.T) {
+	tt := map[string]struct {
+		header   string
+		encoding string
+		expected bool
+	}{
+		"listed":              {header: "gzip, deflate, br", encoding: "br", expected: true},
+		"not listed":          {header: "gzip, deflate", encoding: "br", expected: false},
+		"empty":               {header: "", encoding: "gzip", expected: false},
+		"with quality":        {header: "br;q=0.5, gzip;q=1.0", encoding: "br", expected: true},
+		"refused":             {header: "br;q=0, gzip", encoding: "br", expected: false},
+		"wildcard":            {header: "*", encoding: "br", expected: true},
+		"refused wildcard":    {header: "*;q=0", encoding: "gzip", expected: false},
+		"exact over wildcard": {header: "br;q=0, *", encoding: "br", expected: false},
+		"spaces":              {header: " gzip ; q=0.8 ", encoding: "gzip", expected: true},
+	}
+
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			if actual := acceptsEncoding(tc.header, tc.encoding); actual != tc.expected {
+				t.Errorf("expected: %t, actual: %t", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"todo/internal/logging"
+	"todo/internal/todo"
+)
+
+// createTokenRequest is a JSON body of POST /api/tokens
+type createTokenRequest struct {
+	Name  string     `json:"name"`
+	Scope todo.Scope `json:"scope"`
+}
+
+// createTokenResponse is the only response containing the secret, which is not stored anywhere
+type createTokenResponse struct {
+	todo.Token
+	Secret string `json:"secret"`
+}
+
+// TokensModel is rendered on the page managing the API tokens
+type TokensModel struct {
+	Title  string
+	Tokens []TokenModel
+	// Secret of a token created just now, it is shown only once
+	Secret string
+	CSRF   string
+}
+
+type TokenModel struct {
+	ID        string
+	Name      string
+	Scope     string
+	CreatedAt time.Time
+}
+
+type tokenKey struct{}
+
+// bearer authenticates requests with 'Authorization: Bearer <token>' header and checks the scope of the token.
+// Requests without the header are passed to fallback, e.g. to be authenticated by the session.
+func (h *Http) bearer(next, fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if len(header) == 0 {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		scheme, secret, _ := strings.Cut(header, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			authErr(w, http.StatusUnauthorized, "invalid_request")
+			return
+		}
+
+		t, u, err := h.h.AuthenticateToken(ctx, strings.TrimSpace(secret))
+		if errors.Is(err, todo.ErrTokenNotFound) {
+			slog.InfoContext(ctx, "invalid token", logging.Err(err))
+			authErr(w, http.StatusUnauthorized, "invalid_token")
+			return
+		}
+
+		if err != nil {
+			slog.ErrorContext(ctx, "authenticating the token", logging.Err(err))
+			jsonErr(w, http.StatusInternalServerError)
+			return
+		}
+
+		if !permits(t.Scope, r.Method) {
+			slog.InfoContext(ctx, "insufficient scope", slog.String("token", string(t.ID)), slog.String("scope", string(t.Scope)))
+			authErr(w, http.StatusForbidden, "insufficient_scope")
+			return
+		}
+
+		ctx = logging.WithAttrs(todo.WithUser(ctx, u), slog.String("user_id", string(u.ID)))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, tokenKey{}, t)))
+	})
+}
+
+// permits reports whether the token of the scope can be used for the request method.
+func permits(s todo.Scope, method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return s == todo.ScopeWrite
+	}
+}
+
+// fromSession rejects requests authenticated with a token, so a leaked token can not be used to create more of them.
+func fromSession(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := r.Context().Value(tokenKey{}).(todo.Token); ok {
+		authErr(w, http.StatusForbidden, "insufficient_scope")
+		return false
+	}
+
+	return true
+}
+
+func (h *Http) HandleGetTokens(w http.ResponseWriter, r *http.Request) {
+	if !fromSession(w, r) {
+		return
+	}
+
+	tokens, err := h.h.Tokens(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "listing the tokens", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+// HandlePostToken accepts either a JSON body or a form submitted from the tokens page, which is rendered with the secret.
+func (h *Http) HandlePostToken(w http.ResponseWriter, r *http.Request) {
+	if !fromSession(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	isJSON := hasJSONBody(r)
+	fail := httpErr
+	if isJSON {
+		fail = jsonErr
+	}
+
+	req := createTokenRequest{}
+	if isJSON {
+		err := decodeJSON(r, &req)
+		if err != nil {
+			slog.InfoContext(ctx, "decoding the token", logging.Err(err))
+			fail(w, readErr(err))
+			return
+		}
+	} else {
+		err := r.ParseForm()
+		if err != nil {
+			slog.ErrorContext(ctx, "parsing the form", logging.Err(err))
+			fail(w, readErr(err))
+			return
+		}
+		req.Name = r.Form.Get("name")
+		req.Scope = todo.Scope(r.Form.Get("scope"))
+	}
+
+	t, secret, err := h.h.CreateToken(ctx, todo.CreateToken{Name: req.Name, Scope: req.Scope})
+	if errors.Is(err, todo.ErrInvalidToken) {
+		slog.InfoContext(ctx, "invalid token", logging.Err(err))
+		fail(w, http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "creating the token", logging.Err(err))
+		fail(w, http.StatusInternalServerError)
+		return
+	}
+
+	if !isJSON {
+		h.renderTokens(w, r, http.StatusCreated, secret)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, createTokenResponse{Token: t, Secret: secret})
+}
+
+func (h *Http) HandleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	if !fromSession(w, r) {
+		return
+	}
+
+	err := h.h.RevokeToken(r.Context(), todo.TokenID(r.PathValue("id")))
+	if errors.Is(err, todo.ErrTokenNotFound) {
+		jsonErr(w, http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		slog.ErrorContext(r.Context(), "revoking the token", logging.Err(err))
+		jsonErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Http) renderTokens(w http.ResponseWriter, r *http.Request, status int, secret string) {
+	ctx := r.Context()
+	tokens, err := h.h.Tokens(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "listing the tokens", logging.Err(err))
+		httpErr(w, http.StatusInternalServerError)
+		return
+	}
+
+	models := make([]TokenModel, 0, len(tokens))
+	for _, t := range tokens {
+		models = append(models, TokenModel{ID: string(t.ID), Name: t.Name, Scope: string(t.Scope), CreatedAt: t.CreatedAt})
+	}
+
+	err = h.ui.RenderStatus(w, status, TokensUI, TokensModel{Title: "API tokens", Tokens: models, Secret: secret, CSRF: csrfToken(ctx)})
+	if err != nil {
+		slog.ErrorContext(ctx, "rendering the tokens", logging.Err(err))
+	}
+}
+
+// authErr responds with the error code of RFC 6750 in both WWW-Authenticate header and JSON body,
+// so scripts can tell a missing or revoked token (401) from a token lacking the scope (403).
+func authErr(w http.ResponseWriter, status int, code string) {
+	challenge := `Bearer realm="todos"`
+	if len(code) != 0 {
+		challenge += `, error="` + code + `"`
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeJSON(w, status, errorResponse{Error: http.StatusText(status), Code: code})
+}
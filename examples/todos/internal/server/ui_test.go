@@ -0,0 +1,91 @@
+package server
+
+import (
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	// externalURL matches absolute and protocol relative URLs, not the comments of the scripts
+	externalURL = regexp.MustCompile(`(?i)(https?:)?//[a-z0-9][-a-z0-9.]*\.[a-z]{2,}[^\s"'<>)]*`)
+	// attribute is the name of the attribute, whose value starts at the end of the text
+	attribute = regexp.MustCompile(`([\w-]+)\s*=\s*["']?$`)
+)
+
+// Test_noExternalOrigins makes sure the pages render without loading anything from the other origins, e.g. a CDN.
+// Only the namespace of SVG and the links followed by the user are allowed, since the browser fetches neither of them on its own.
+func Test_noExternalOrigins(t *testing.T) {
+	for name, fsys := range map[string]fs.FS{"ui": uiFS, "static": staticFS} {
+		err := fs.WalkDir(fsys, name, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+
+			content, err := fs.ReadFile(fsys, path)
+			if err != nil {
+				return err
+			}
+
+			text := string(content)
+			for _, loc := range externalURL.FindAllStringIndex(text, -1) {
+				before := text[:loc[0]]
+				attr := attribute.FindStringSubmatch(before)
+				tag := before[strings.LastIndex(before, "<")+1:]
+				switch {
+				case attr != nil && attr[1] == "xmlns":
+				case attr != nil && attr[1] == "href" && strings.HasPrefix(tag, "a "):
+				default:
+					line := strings.Count(before, "\n") + 1
+					t.Errorf("%s:%d references external origin: %s", path, line, text[loc[0]:loc[1]])
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("walking %s: %v", name, err)
+		}
+	}
+}
+
+var (
+	classAttr   = regexp.MustCompile(`class="([^"]*)"`)
+	action      = regexp.MustCompile(`{{[^}]*}}`)
+	cssSelector = regexp.MustCompile(`\.((?:\\.|[\w-])+)`)
+)
+
+// Test_templateClasses makes sure the vendored subset of Tailwind defines every class used by the templates.
+func Test_templateClasses(t *testing.T) {
+	css, err := fs.ReadFile(staticFS, "static/tailwind.css")
+	if err != nil {
+		t.Fatalf("reading the styles: %v", err)
+	}
+
+	defined := make(map[string]bool)
+	for _, m := range cssSelector.FindAllStringSubmatch(string(css), -1) {
+		defined[strings.ReplaceAll(m[1], `\`, "")] = true
+	}
+
+	templates, err := fs.Glob(uiFS, "ui/*.gohtml")
+	if err != nil {
+		t.Fatalf("listing templates: %v", err)
+	}
+
+	for _, name := range templates {
+		content, err := fs.ReadFile(uiFS, name)
+		if err != nil {
+			t.Fatalf("reading template: %s, %v", name, err)
+		}
+
+		for _, m := range classAttr.FindAllStringSubmatch(string(content), -1) {
+			// classes chosen by the conditions are all listed in the text of the attribute
+			for _, class := range strings.Fields(action.ReplaceAllString(m[1], " ")) {
+				if !defined[class] {
+					t.Errorf("%s uses class: %s, which is not defined in tailwind.css", name, class)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package todo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// EventKind tells what happened to the task of an Event.
+type EventKind string
+
+const (
+	TaskCreated EventKind = "created"
+	TaskUpdated EventKind = "updated"
+	TaskToggled EventKind = "toggled"
+	TaskDeleted EventKind = "deleted"
+)
+
+// Event is a change of a task, published by the Handler once the change is stored, see Handler.Subscribe.
+type Event struct {
+	// ID is greater than the id of every event published before, also by the previous runs of the process
+	ID   uint64    `json:"id"`
+	Kind EventKind `json:"kind"`
+	// Task is the state after the change, for TaskDeleted it is the last stored state
+	Task Task `json:"task"`
+}
+
+// Subscription streams the events of the tasks of a single user.
+type Subscription struct {
+	// Events are closed when the context of the subscription is done or the subscriber does not keep up with them,
+	// in the latter case the subscriber can subscribe again after the last received event.
+	Events <-chan Event
+	// Missed is true when some of the events following the requested one are not retained anymore,
+	// e.g. the subscriber was away for too long or the process was restarted, so the subscriber must read the tasks again.
+	Missed bool
+	// LastID is the id of the last event published before the subscription started
+	LastID uint64
+}
+
+const (
+	// retainedEvents are replayed to the subscribers catching up after a reconnect
+	retainedEvents = 256
+	// subscriberBuffer is the number of events a subscriber can fall behind before it is dropped
+	subscriberBuffer = 64
+)
+
+// broker is an in-process pub/sub of the events. Publishing never blocks, a subscriber which falls behind is dropped.
+type broker struct {
+	mu     sync.Mutex
+	lastID uint64
+	// retained are the most recent events, oldest first
+	retained []Event
+	subs     map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	owner  UserID
+	events chan Event
+}
+
+func newBroker() *broker {
+	return &broker{
+		// the ids of a restarted process continue after the previous ones, so a reconnecting subscriber can tell it missed the events
+		lastID: uint64(time.Now().UnixNano()),
+		subs:   make(map[*subscriber]struct{}),
+	}
+}
+
+func (b *broker) publish(kind EventKind, t Task) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e := Event{ID: b.lastID, Kind: kind, Task: t}
+	if len(b.retained) == retainedEvents {
+		b.retained = append(b.retained[:0], b.retained[1:]...)
+	}
+	b.retained = append(b.retained, e)
+
+	for s := range b.subs {
+		if s.owner != t.OwnerID {
+			continue
+		}
+
+		select {
+		case s.events <- e:
+		default:
+			b.drop(s)
+		}
+	}
+}
+
+// subscribe replays the retained events of the owner published after the event with id after, zero means only new events.
+// Replaying and registering happens under the lock, so no event is lost or repeated in between.
+func (b *broker) subscribe(ctx context.Context, owner UserID, after uint64) Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := Subscription{LastID: b.lastID}
+	var replay []Event
+	if after != 0 {
+		oldest := b.lastID + 1
+		if len(b.retained) != 0 {
+			oldest = b.retained[0].ID
+		}
+		// an id from the future comes from a process with the clock set back, nothing can be replayed safely
+		sub.Missed = after+1 < oldest || after > b.lastID
+
+		for _, e := range b.retained {
+			if !sub.Missed && e.ID > after && e.Task.OwnerID == owner {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	s := &subscriber{owner: owner, events: make(chan Event, len(replay)+subscriberBuffer)}
+	for _, e := range replay {
+		s.events <- e
+	}
+	sub.Events = s.events
+
+	b.subs[s] = struct{}{}
+	context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.drop(s)
+	})
+
+	return sub
+}
+
+// drop closes the events of the subscriber, unless they are already closed. It must be called with the lock held.
+func (b *broker) drop(s *subscriber) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+
+	delete(b.subs, s)
+	close(s.events)
+}
+
+// Subscribe streams the changes of the tasks of the user of the context, until the context is done.
+// The events published after the event with id after are replayed first, zero means only new events are streamed.
+func (h *Handler) Subscribe(ctx context.Context, after uint64) Subscription {
+	return h.events.subscribe(ctx, owner(ctx), after)
+}
@@ -0,0 +1,122 @@
+package todo_test
+
+import (
+	"context"
+	"go.uber.org/goleak"
+	"strconv"
+	"testing"
+	"time"
+	"todo/internal/memory"
+	"todo/internal/todo"
+)
+
+func TestMain(m *testing.M) {
+	// subscriptions must not leave anything behind once their context is done
+	goleak.VerifyTestMain(m)
+}
+
+func Test_Handler_Subscribe(t *testing.T) {
+	s := memory.NewTaskStorage()
+	h := todo.NewHandler(s, s, s)
+	alice := todo.WithUser(context.Background(), todo.User{ID: "alice"})
+	bob := todo.WithUser(context.Background(), todo.User{ID: "bob"})
+
+	ctx, cancel := context.WithCancel(alice)
+	sub := h.Subscribe(ctx, 0)
+	if sub.Missed {
+		t.Errorf("expected nothing to be missed by a new subscription")
+	}
+
+	created := must(h.Create(alice, todo.CreateTask{Title: "first"}))
+	must(h.Create(bob, todo.CreateTask{Title: "not for alice"}))
+	must(h.Toggle(alice, created.ID, 0))
+	must(h.Update(alice, todo.UpdateTask{ID: created.ID, Title: "renamed"}))
+	if err := h.Delete(alice, created.ID, 0); err != nil {
+		t.Fatalf("deleting the task: %v", err)
+	}
+
+	var received []todo.Event
+	for _, kind := range []todo.EventKind{todo.TaskCreated, todo.TaskToggled, todo.TaskUpdated, todo.TaskDeleted} {
+		e := receive(t, sub.Events)
+		if e.Kind != kind || e.Task.ID != created.ID {
+			t.Errorf("expected %s of: %s, got: %s of: %s", kind, created.ID, e.Kind, e.Task.ID)
+		}
+
+		if len(received) != 0 && e.ID <= received[len(received)-1].ID {
+			t.Errorf("expected ids to grow, got: %d after: %d", e.ID, received[len(received)-1].ID)
+		}
+		received = append(received, e)
+	}
+
+	cancel()
+	if _, ok := <-sub.Events; ok {
+		t.Errorf("expected the events to be closed once the context is done")
+	}
+
+	t.Run("replays after the last received event", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(alice)
+		defer cancel()
+
+		sub := h.Subscribe(ctx, received[1].ID)
+		if sub.Missed {
+			t.Errorf("expected retained events not to be missed")
+		}
+
+		for _, expected := range received[2:] {
+			if e := receive(t, sub.Events); e.ID != expected.ID {
+				t.Errorf("expected replay of: %d, got: %d", expected.ID, e.ID)
+			}
+		}
+	})
+
+	t.Run("reports events which are not retained", func(t *testing.T) {
+		for i := 0; i < 300; i++ {
+			must(h.Create(bob, todo.CreateTask{Title: strconv.Itoa(i)}))
+		}
+
+		ctx, cancel := context.WithCancel(alice)
+		defer cancel()
+
+		if sub := h.Subscribe(ctx, received[0].ID); !sub.Missed {
+			t.Errorf("expected the events to be missed")
+		}
+	})
+
+	t.Run("drops subscriber falling behind", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(bob)
+		defer cancel()
+
+		sub := h.Subscribe(ctx, 0)
+		for i := 0; i < 100; i++ {
+			must(h.Create(bob, todo.CreateTask{Title: strconv.Itoa(i)}))
+		}
+
+		n := 0
+		for range sub.Events {
+			n++
+		}
+
+		if n == 0 || n == 100 {
+			t.Errorf("expected the subscriber to get some of the events before it was dropped, got: %d", n)
+		}
+	})
+}
+
+func receive(t *testing.T, events <-chan todo.Event) todo.Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("expected an event")
+		return todo.Event{}
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
@@ -0,0 +1,113 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ChangeKind tells what changed in a task, a single write can make several changes, e.g. rename it and change the deadline.
+type ChangeKind string
+
+const (
+	ChangeCreated         ChangeKind = "created"
+	ChangeRenamed         ChangeKind = "renamed"
+	ChangeToggled         ChangeKind = "toggled"
+	ChangeDeadlineChanged ChangeKind = "deadline_changed"
+	ChangeDeleted         ChangeKind = "deleted"
+)
+
+// Change is an entry of the append-only history of a task, see HistoryStorage.
+type Change struct {
+	TaskID ID         `json:"task_id"`
+	Kind   ChangeKind `json:"kind"`
+	// At is the time of the change with seconds precision
+	At time.Time `json:"at"`
+	// ActorID is the user who made the change, empty for the changes made without a user
+	ActorID UserID `json:"actor_id"`
+	// Actor is the name of the user who made the change
+	Actor string `json:"actor"`
+	// Title, Deadline, Done and Version are the state of the task after the change, the last state for a deletion
+	Title    string     `json:"title"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+	Done     bool       `json:"done"`
+	Version  int        `json:"version"`
+}
+
+// HistoryStorage is implemented by the storages, which record the changes of the tasks.
+// Upsert, Toggle and Delete record the changes along with the state, so either both or none of them are stored.
+// The actor of a change is the user of the context, see WithUser.
+type HistoryStorage interface {
+	// History returns the changes of the task of the owner, oldest first. It is empty if there is no such task.
+	History(ctx context.Context, id ID, owner UserID) ([]Change, error)
+}
+
+// ChangesOf lists the changes made by the write of the task, before is nil if the task is created.
+func ChangesOf(before *Task, after Task) []ChangeKind {
+	if before == nil {
+		return []ChangeKind{ChangeCreated}
+	}
+
+	var out []ChangeKind
+	if before.Title != after.Title {
+		out = append(out, ChangeRenamed)
+	}
+
+	if !sameDeadline(before.Deadline, after.Deadline) {
+		out = append(out, ChangeDeadlineChanged)
+	}
+
+	if before.Done != after.Done {
+		out = append(out, ChangeToggled)
+	}
+
+	return out
+}
+
+func sameDeadline(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
+
+// NewChange returns the change of the task made by the user of the context at the time.
+func NewChange(ctx context.Context, kind ChangeKind, t Task, at time.Time) Change {
+	user, _ := UserFromContext(ctx)
+	return Change{
+		TaskID:   t.ID,
+		Kind:     kind,
+		At:       at.UTC().Truncate(time.Second),
+		ActorID:  user.ID,
+		Actor:    user.Name,
+		Title:    t.Title,
+		Deadline: t.Deadline,
+		Done:     t.Done,
+		Version:  t.Version,
+	}
+}
+
+// History returns the changes of the task of the user, including its deletion.
+// It returns ErrTaskNotFound if the user never had such task and ErrNoHistory if the storage does not record it.
+func (h *Handler) History(ctx context.Context, id ID) ([]Change, error) {
+	hs, ok := h.s.(HistoryStorage)
+	if !ok {
+		return nil, ErrNoHistory
+	}
+
+	changes, err := hs.History(ctx, id, owner(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("getting history of task: %s, %w", id, err)
+	}
+
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("history of task: %s, %w", id, ErrTaskNotFound)
+	}
+
+	return changes, nil
+}
+
+// ErrNoHistory is returned when the storage does not implement HistoryStorage.
+var ErrNoHistory = errors.New("storage does not record the history of tasks")
@@ -0,0 +1,197 @@
+package todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+type ListID string
+
+func (i ListID) String() string {
+	return "ListID[" + string(i) + "]"
+}
+
+// DefaultListID is the list of the tasks the user created without choosing the list. It can not be archived.
+// Every user has their own default list, which is created when it is needed for the first time, see Handler.GetList.
+// The default list of the tasks created without a user is the list all the tasks belonged to before the accounts.
+func DefaultListID(owner UserID) ListID {
+	if len(owner) == 0 {
+		return "default"
+	}
+
+	return ListID("default-" + string(owner))
+}
+
+// List groups the tasks. Archived list is hidden, its tasks are kept, but no new tasks can be added.
+type List struct {
+	ID       ListID `json:"id"`
+	Name     string `json:"name"`
+	Archived bool   `json:"archived"`
+	// OwnerID is the user who created the list, nobody else can access it
+	OwnerID UserID `json:"-"`
+}
+
+type ListStorage interface {
+	// UpsertList stores the list, the owner is set only when the list is created.
+	// It returns ErrListNotFound if the list exists and is owned by someone else.
+	UpsertList(ctx context.Context, l List) (List, error)
+	// GetList returns ErrListNotFound if the owner has no such list.
+	GetList(ctx context.Context, id ListID, owner UserID) (List, error)
+	// Lists returns the lists of the owner ordered by name, archived ones only if requested.
+	Lists(ctx context.Context, owner UserID, archived bool) ([]List, error)
+}
+
+func (h *Handler) CreateList(ctx context.Context, cmd CreateList) (List, error) {
+	err := validateName(cmd.Name)
+	if err != nil {
+		return List{}, err
+	}
+
+	l := List{ID: ListID(RandomID()), Name: cmd.Name, OwnerID: owner(ctx)}
+	stored, err := h.l.UpsertList(ctx, l)
+	if err != nil {
+		return List{}, fmt.Errorf("upserting the list: %v, %w", l, err)
+	}
+
+	return stored, nil
+}
+
+// GetList returns the list of the user of the context or ErrListNotFound if the user has no such list.
+// The default list of the user is created if it does not exist yet, see DefaultListID.
+func (h *Handler) GetList(ctx context.Context, id ListID) (List, error) {
+	o := owner(ctx)
+	l, err := h.l.GetList(ctx, id, o)
+	if errors.Is(err, ErrListNotFound) && id == DefaultListID(o) {
+		l, err = h.l.UpsertList(ctx, List{ID: id, Name: defaultListName(ctx), OwnerID: o})
+	}
+
+	if err != nil {
+		return List{}, fmt.Errorf("getting list: %s, %w", id, err)
+	}
+
+	return l, nil
+}
+
+// Lists returns the lists of the user of the context, including the default one.
+func (h *Handler) Lists(ctx context.Context, archived bool) ([]List, error) {
+	o := owner(ctx)
+	_, err := h.GetList(ctx, DefaultListID(o))
+	if err != nil {
+		return nil, fmt.Errorf("getting the default list, %w", err)
+	}
+
+	lists, err := h.l.Lists(ctx, o, archived)
+	if err != nil {
+		return nil, fmt.Errorf("listing lists of: %s, archived: %t, %w", o, archived, err)
+	}
+
+	return lists, nil
+}
+
+// UpdateList renames, archives or restores the list, the whole command is validated before the list is stored.
+func (h *Handler) UpdateList(ctx context.Context, id ListID, cmd UpdateList) (List, error) {
+	if cmd.Name != nil {
+		err := validateName(*cmd.Name)
+		if err != nil {
+			return List{}, err
+		}
+	}
+
+	return h.updateList(ctx, id, func(l *List) error {
+		if cmd.Archived != nil && *cmd.Archived && l.ID == DefaultListID(l.OwnerID) {
+			return fmt.Errorf("default list can not be archived, %w", ErrInvalidList)
+		}
+
+		if cmd.Name != nil {
+			l.Name = *cmd.Name
+		}
+
+		if cmd.Archived != nil {
+			l.Archived = *cmd.Archived
+		}
+
+		return nil
+	})
+}
+
+func (h *Handler) updateList(ctx context.Context, id ListID, update func(l *List) error) (List, error) {
+	found, err := h.GetList(ctx, id)
+	if err != nil {
+		return List{}, err
+	}
+
+	err = update(&found)
+	if err != nil {
+		return List{}, err
+	}
+
+	stored, err := h.l.UpsertList(ctx, found)
+	if err != nil {
+		return List{}, fmt.Errorf("upserting list: %s after updating it, %w", id, err)
+	}
+
+	return stored, nil
+}
+
+// writableList returns an error wrapping ErrInvalidTask if the user of the context can not add tasks to the list.
+func (h *Handler) writableList(ctx context.Context, id ListID) error {
+	l, err := h.GetList(ctx, id)
+	if errors.Is(err, ErrListNotFound) {
+		return fmt.Errorf("list: %s does not exist, %w", id, ErrInvalidTask)
+	}
+
+	if err != nil {
+		return fmt.Errorf("getting list: %s of the task, %w", id, err)
+	}
+
+	if l.Archived {
+		return fmt.Errorf("list: %s is archived, %w", id, ErrInvalidTask)
+	}
+
+	return nil
+}
+
+// defaultListName is the name of the default list until it is renamed
+func defaultListName(ctx context.Context) string {
+	u, ok := UserFromContext(ctx)
+	if !ok || len(u.Name) == 0 {
+		return "Tasks"
+	}
+
+	return u.Name + "'s tasks"
+}
+
+type CreateList struct {
+	Name string
+}
+
+type UpdateList struct {
+	// Name is optional - nil keeps the name
+	Name *string
+	// Archived is optional - nil keeps the list archived or not
+	Archived *bool
+}
+
+// MaxNameLength is the maximum number of characters in a list's name.
+const MaxNameLength = 64
+
+func validateName(name string) error {
+	if len(strings.TrimSpace(name)) == 0 {
+		return fmt.Errorf("name must not be blank, %w", ErrInvalidList)
+	}
+
+	if n := utf8.RuneCountInString(name); n > MaxNameLength {
+		return fmt.Errorf("name must have at most %d characters, has: %d, %w", MaxNameLength, n, ErrInvalidList)
+	}
+
+	return nil
+}
+
+var (
+	ErrListNotFound = errors.New("list not found")
+	// ErrInvalidList is returned when a list command does not pass the validation.
+	ErrInvalidList = errors.New("invalid list")
+)
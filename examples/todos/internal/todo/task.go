@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type ID string
@@ -15,46 +17,112 @@ func (i ID) String() string {
 	return "ID[" + string(i) + "]"
 }
 
-var (
-	seed = rand.Int63()
-	src  = rand.NewSource(seed)
-)
-
+// RandomID is safe for concurrent use, unlike a rand.Source created with rand.NewSource.
 func RandomID() ID {
 	// standard library does not implement UUIDs :(
-	return ID(strconv.Itoa(int(src.Int63())))
+	return ID(strconv.Itoa(int(rand.Int63())))
 }
 
 type Task struct {
-	ID       ID
-	Title    string
-	Deadline *time.Time
-	Done     bool
+	ID       ID         `json:"id"`
+	Title    string     `json:"title"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+	Done     bool       `json:"done"`
+	ListID   ListID     `json:"list_id"`
+	// OwnerID is the user who created the task, nobody else can access it
+	OwnerID UserID `json:"-"`
+	// Version is incremented by the Storage on every write, zero means the task was never stored
+	Version int `json:"version"`
 }
 
 type Storage interface {
+	// Upsert stores the task if its version matches the stored one, which is zero for a new task.
+	// It returns ErrStaleTask if the task was modified in the meantime.
 	Upsert(ctx context.Context, t Task) (stored Task, err error)
 	List(ctx context.Context, f *TaskFilter) ([]Task, error)
+	// Toggle atomically flips the Done state of the task, so concurrent toggles are never lost.
+	// Non-zero version must match the stored one, otherwise it returns ErrStaleTask.
+	// It returns ErrTaskNotFound if there is no such task.
+	Toggle(ctx context.Context, id ID, version int) (Task, error)
+	// Delete removes the task by its id, non-zero version must match the stored one, otherwise it returns ErrStaleTask.
+	// It returns ErrTaskNotFound if there is no such task.
+	Delete(ctx context.Context, id ID, version int) error
 }
 
+// TaskCounter is implemented by the storages to expose the number of tasks in the metrics.
+type TaskCounter interface {
+	// CountTasks returns the number of done and undone tasks of all the users.
+	CountTasks(ctx context.Context) (done, undone int, err error)
+}
+
+// TaskFilter narrows down the tasks returned by Storage.List.
+// Zero value of every field means no filtering by the field, so nil filter matches every task.
 type TaskFilter struct {
-	ID *ID
+	ID      *ID
+	ListID  *ListID
+	OwnerID *UserID
+	// Done matches either done or undone tasks
+	Done *bool
+	// DeadlineBefore matches tasks with the deadline strictly before the time, tasks without the deadline are excluded
+	DeadlineBefore *time.Time
+	// DeadlineAfter matches tasks with the deadline strictly after the time, tasks without the deadline are excluded
+	DeadlineAfter *time.Time
+	// TitleContains matches tasks containing the text in the title, case-insensitive
+	TitleContains string
+	SortBy        SortBy
+	Descending    bool
+	// Limit is the maximum number of returned tasks
+	Limit int
+	// After is a cursor - id of the last task from the previous page.
+	// Tasks following it in the sort order are returned. If there is no such task, the page is empty.
+	After *ID
 }
 
+// SortBy is a key of ordering of the tasks. Ties are always broken by the ID.
+type SortBy string
+
+const (
+	SortByID    SortBy = "id"
+	SortByTitle SortBy = "title"
+	// SortByDeadline puts tasks without the deadline last (first when descending)
+	SortByDeadline SortBy = "deadline"
+)
+
+// Handler accesses only the tasks of the user of the context, see WithUser.
+// It publishes the stored changes of the tasks to the subscribers, see Subscribe.
 type Handler struct {
-	s Storage
+	s      Storage
+	l      ListStorage
+	u      UserStorage
+	events *broker
 }
 
-func NewHandler(s Storage) *Handler {
-	return &Handler{s: s}
+func NewHandler(s Storage, l ListStorage, u UserStorage) *Handler {
+	return &Handler{s: s, l: l, u: u, events: newBroker()}
 }
 
 func (h *Handler) Create(ctx context.Context, cmd CreateTask) (Task, error) {
+	err := cmd.Validate()
+	if err != nil {
+		return Task{}, err
+	}
+
+	if len(cmd.ListID) == 0 {
+		cmd.ListID = DefaultListID(owner(ctx))
+	}
+
+	err = h.writableList(ctx, cmd.ListID)
+	if err != nil {
+		return Task{}, err
+	}
+
 	var t = Task{
 		ID:       RandomID(),
 		Title:    cmd.Title,
 		Deadline: cmd.Deadline,
 		Done:     false,
+		ListID:   cmd.ListID,
+		OwnerID:  owner(ctx),
 	}
 
 	stored, err := h.s.Upsert(ctx, t)
@@ -62,13 +130,15 @@ func (h *Handler) Create(ctx context.Context, cmd CreateTask) (Task, error) {
 		return Task{}, fmt.Errorf("upserting the task: %v, %w", t, err)
 	}
 
+	h.events.publish(TaskCreated, stored)
 	return stored, nil
 }
 
-func (h *Handler) Toggle(ctx context.Context, id ID) (Task, error) {
-	tasks, err := h.s.List(ctx, &TaskFilter{ID: &id})
+// Get returns a single task by its id or ErrTaskNotFound if there is no such task.
+func (h *Handler) Get(ctx context.Context, id ID) (Task, error) {
+	tasks, err := h.List(ctx, &TaskFilter{ID: &id})
 	if err != nil {
-		return Task{}, fmt.Errorf("listing task to toggle by id: %s, %w", id, err)
+		return Task{}, fmt.Errorf("listing task by id: %s, %w", id, err)
 	}
 
 	if len(tasks) == 0 {
@@ -79,21 +149,143 @@ func (h *Handler) Toggle(ctx context.Context, id ID) (Task, error) {
 		return Task{}, fmt.Errorf("expected to find one task by id: %s, found: %d", id, v)
 	}
 
-	found := tasks[0]
-	found.Done = !found.Done
+	return tasks[0], nil
+}
+
+// List returns the tasks matching the filter, which are owned by the user of the context.
+func (h *Handler) List(ctx context.Context, f *TaskFilter) ([]Task, error) {
+	owned := TaskFilter{}
+	if f != nil {
+		owned = *f
+	}
+
+	o := owner(ctx)
+	owned.OwnerID = &o
+	tasks, err := h.s.List(ctx, &owned)
+	if err != nil {
+		return nil, fmt.Errorf("listing tasks of: %s, %w", o, err)
+	}
+
+	return tasks, nil
+}
+
+// Toggle flips the Done state of the task in the version, zero means the task is toggled regardless of its version.
+// It returns ErrStaleTask if the task is in a different version.
+func (h *Handler) Toggle(ctx context.Context, id ID, version int) (Task, error) {
+	// the owner never changes, so checking it before toggling is not racy
+	_, err := h.Get(ctx, id)
+	if err != nil {
+		return Task{}, fmt.Errorf("getting task to toggle, %w", err)
+	}
+
+	toggled, err := h.s.Toggle(ctx, id, version)
+	if err != nil {
+		return Task{}, fmt.Errorf("toggling task: %s, %w", id, err)
+	}
+
+	h.events.publish(TaskToggled, toggled)
+	return toggled, nil
+}
+
+// Update changes the title and the deadline of an existing task.
+// It returns ErrTaskNotFound if there is no such task.
+func (h *Handler) Update(ctx context.Context, cmd UpdateTask) (Task, error) {
+	err := cmd.Validate()
+	if err != nil {
+		return Task{}, err
+	}
+
+	found, err := h.Get(ctx, cmd.ID)
+	if err != nil {
+		return Task{}, fmt.Errorf("getting task to update, %w", err)
+	}
+
+	if cmd.Version != 0 && cmd.Version != found.Version {
+		return Task{}, fmt.Errorf("updating task: %s in version: %d, current: %d, %w", cmd.ID, cmd.Version, found.Version, ErrStaleTask)
+	}
+
+	found.Title = cmd.Title
+	found.Deadline = cmd.Deadline
+	if cmd.Done != nil {
+		found.Done = *cmd.Done
+	}
 
 	stored, err := h.s.Upsert(ctx, found)
 	if err != nil {
-		return Task{}, fmt.Errorf("upserting task: %s after toggling it: ")
+		return Task{}, fmt.Errorf("upserting task: %s after updating it, %w", cmd.ID, err)
 	}
 
+	h.events.publish(TaskUpdated, stored)
 	return stored, nil
 }
 
+// Delete removes the task in the version, zero means the task is deleted regardless of its version.
+// It returns ErrStaleTask if the task is in a different version.
+func (h *Handler) Delete(ctx context.Context, id ID, version int) error {
+	found, err := h.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("getting task to delete, %w", err)
+	}
+
+	err = h.s.Delete(ctx, id, version)
+	if err != nil {
+		return fmt.Errorf("deleting task: %s, %w", id, err)
+	}
+
+	h.events.publish(TaskDeleted, found)
+	return nil
+}
+
 type CreateTask struct {
 	Title string
 	// Deadline is optional - nil means there is no deadline
 	Deadline *time.Time
+	// ListID is optional - empty means the default list
+	ListID ListID
+}
+
+func (c CreateTask) Validate() error {
+	return validateTitle(c.Title)
 }
 
-var ErrTaskNotFound = errors.New("task not found")
+type UpdateTask struct {
+	ID    ID
+	Title string
+	// Deadline is optional - nil means there is no deadline
+	Deadline *time.Time
+	// Done is optional - nil leaves the task's state untouched
+	Done *bool
+	// Version is optional - zero means the task is updated regardless of its version
+	Version int
+}
+
+func (c UpdateTask) Validate() error {
+	if len(c.ID) == 0 {
+		return fmt.Errorf("id must not be empty, %w", ErrInvalidTask)
+	}
+
+	return validateTitle(c.Title)
+}
+
+// MaxTitleLength is the maximum number of characters in a task's title.
+const MaxTitleLength = 256
+
+func validateTitle(title string) error {
+	if len(strings.TrimSpace(title)) == 0 {
+		return fmt.Errorf("title must not be blank, %w", ErrInvalidTask)
+	}
+
+	if n := utf8.RuneCountInString(title); n > MaxTitleLength {
+		return fmt.Errorf("title must have at most %d characters, has: %d, %w", MaxTitleLength, n, ErrInvalidTask)
+	}
+
+	return nil
+}
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrInvalidTask is returned when a command does not pass the validation.
+	ErrInvalidTask = errors.New("invalid task")
+	// ErrStaleTask is returned when the task was modified since it was read.
+	ErrStaleTask = errors.New("task was modified concurrently")
+)
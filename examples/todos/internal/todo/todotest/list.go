@@ -0,0 +1,100 @@
+package todotest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"todo/internal/todo"
+)
+
+// ShouldBehaveLikeListStorage runs the behavioural suite of todo.ListStorage.
+// Every subtest gets its own storage from newStorage, which contains no lists of the users.
+func ShouldBehaveLikeListStorage(t *testing.T, newStorage func(t *testing.T) todo.ListStorage) {
+	t.Run("upsert", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+
+		created, err := s.UpsertList(ctx, todo.List{ID: "work", Name: "Work", OwnerID: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		created.Name = "Job"
+		created.Archived = true
+		if _, err = s.UpsertList(ctx, created); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := s.GetList(ctx, "work", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found != created {
+			t.Errorf("expected: %+v, got: %+v", created, found)
+		}
+	})
+
+	t.Run("lists are sorted by name and archived ones are hidden", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+
+		for _, l := range []todo.List{
+			{ID: "b", Name: "bills", OwnerID: "alice"},
+			{ID: "a", Name: "Archive", Archived: true, OwnerID: "alice"},
+			{ID: "c", Name: "Chores", OwnerID: "alice"},
+			{ID: "d", Name: "Drafts", OwnerID: "bob"},
+		} {
+			if _, err := s.UpsertList(ctx, l); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for archived, expected := range map[bool][]todo.ListID{
+			false: {"b", "c"},
+			true:  {"a", "b", "c"},
+		} {
+			lists, err := s.Lists(ctx, "alice", archived)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]todo.ListID, 0, len(lists))
+			for _, l := range lists {
+				ids = append(ids, l.ID)
+			}
+
+			if !slices.Equal(expected, ids) {
+				t.Errorf("archived: %t, expected: %v, got: %v", archived, expected, ids)
+			}
+		}
+	})
+
+	t.Run("lists of other owners are not accessible", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+
+		if _, err := s.UpsertList(ctx, todo.List{ID: "work", Name: "Work", OwnerID: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.GetList(ctx, "work", "bob"); !errors.Is(err, todo.ErrListNotFound) {
+			t.Errorf("get, expected: %v, got: %v", todo.ErrListNotFound, err)
+		}
+
+		if _, err := s.UpsertList(ctx, todo.List{ID: "work", Name: "Taken", OwnerID: "bob"}); !errors.Is(err, todo.ErrListNotFound) {
+			t.Errorf("upsert, expected: %v, got: %v", todo.ErrListNotFound, err)
+		}
+
+		if found, err := s.GetList(ctx, "work", "alice"); err != nil || found.Name != "Work" {
+			t.Errorf("rejected write must not change the list, got: %+v, %v", found, err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := newStorage(t).GetList(context.Background(), "missing", "alice"); !errors.Is(err, todo.ErrListNotFound) {
+			t.Errorf("expected: %v, got: %v", todo.ErrListNotFound, err)
+		}
+	})
+}
@@ -0,0 +1,542 @@
+// Package todotest verifies, that implementations of todo.Storage keep the same contract.
+package todotest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"todo/internal/todo"
+)
+
+// ShouldBehaveLikeStorage runs the behavioural suite of todo.Storage.
+// Every subtest gets its own, empty storage from newStorage.
+func ShouldBehaveLikeStorage(t *testing.T, newStorage func(t *testing.T) todo.Storage) {
+	t.Run("upsert", func(t *testing.T) { upsert(t, newStorage(t)) })
+	t.Run("filter", func(t *testing.T) { filter(t, newStorage(t)) })
+	t.Run("not found", func(t *testing.T) { notFound(t, newStorage(t)) })
+	t.Run("deadline", func(t *testing.T) { deadline(t, newStorage(t)) })
+	t.Run("cancelled context", func(t *testing.T) { cancelled(t, newStorage(t)) })
+	t.Run("concurrency", func(t *testing.T) { concurrency(t, newStorage(t)) })
+	t.Run("count", func(t *testing.T) { count(t, newStorage(t)) })
+	t.Run("history", func(t *testing.T) { history(t, newStorage(t)) })
+}
+
+func upsert(t *testing.T, s todo.Storage) {
+	ctx := context.Background()
+
+	created, err := s.Upsert(ctx, todo.Task{ID: "a", Title: "first", ListID: todo.DefaultListID("")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created.ID != "a" || created.Title != "first" || created.Done || created.Deadline != nil || created.ListID != todo.DefaultListID("") || created.Version != 1 {
+		t.Fatalf("unexpected created task: %+v", created)
+	}
+
+	created.Title = "second"
+	created.Done = true
+	updated, err := s.Upsert(ctx, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Title != "second" || !updated.Done || updated.Version != 2 {
+		t.Errorf("unexpected updated task: %+v", updated)
+	}
+
+	if found := get(t, s, "a"); found != updated {
+		t.Errorf("listed task: %+v is different than upserted one: %+v", found, updated)
+	}
+
+	t.Run("stale write is rejected", func(t *testing.T) {
+		created.Title = "lost update"
+		if _, err := s.Upsert(ctx, created); !errors.Is(err, todo.ErrStaleTask) {
+			t.Errorf("expected: %v, got: %v", todo.ErrStaleTask, err)
+		}
+	})
+
+	t.Run("new task does not overwrite existing one", func(t *testing.T) {
+		if _, err := s.Upsert(ctx, todo.Task{ID: "a", Title: "duplicate"}); !errors.Is(err, todo.ErrStaleTask) {
+			t.Errorf("expected: %v, got: %v", todo.ErrStaleTask, err)
+		}
+
+		if found := get(t, s, "a"); found.Title != "second" {
+			t.Errorf("rejected write must not change the task, got: %+v", found)
+		}
+	})
+
+	t.Run("owner is set only on creation", func(t *testing.T) {
+		owned, err := s.Upsert(ctx, todo.Task{ID: "owned", Title: "mine", OwnerID: "alice"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		owned.OwnerID = "mallory"
+		if _, err = s.Upsert(ctx, owned); err != nil {
+			t.Fatal(err)
+		}
+
+		if found := get(t, s, "owned"); found.OwnerID != "alice" {
+			t.Errorf("expected the owner not to change, got: %+v", found)
+		}
+
+		if err = s.Delete(ctx, "owned", 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("toggle increments the version", func(t *testing.T) {
+		toggled, err := s.Toggle(ctx, "a", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if toggled.Version != 3 || toggled.Title != "second" || toggled.Done {
+			t.Errorf("unexpected toggled task: %+v", toggled)
+		}
+	})
+
+	t.Run("stale toggle and delete are rejected", func(t *testing.T) {
+		if _, err := s.Toggle(ctx, "a", 2); !errors.Is(err, todo.ErrStaleTask) {
+			t.Errorf("toggle, expected: %v, got: %v", todo.ErrStaleTask, err)
+		}
+
+		if err := s.Delete(ctx, "a", 2); !errors.Is(err, todo.ErrStaleTask) {
+			t.Errorf("delete, expected: %v, got: %v", todo.ErrStaleTask, err)
+		}
+
+		if found := get(t, s, "a"); found.Version != 3 {
+			t.Errorf("rejected writes must not change the task, got: %+v", found)
+		}
+
+		if _, err := s.Toggle(ctx, "missing", 1); !errors.Is(err, todo.ErrTaskNotFound) {
+			t.Errorf("toggle of missing task, expected: %v, got: %v", todo.ErrTaskNotFound, err)
+		}
+	})
+
+	t.Run("deleted task is not listed", func(t *testing.T) {
+		if err := s.Delete(ctx, "a", 3); err != nil {
+			t.Fatal(err)
+		}
+
+		if found := list(t, s, nil); len(found) != 0 {
+			t.Errorf("expected no tasks, got: %v", found)
+		}
+	})
+}
+
+func filter(t *testing.T, s todo.Storage) {
+	ctx := context.Background()
+
+	warsaw := location(t, "Europe/Warsaw")
+	// 17:30 UTC sorts before 18:00 UTC even though '18:30+01:00' > '18:00Z' as a string
+	early := time.Date(2024, 3, 20, 18, 30, 0, 0, warsaw)
+	late := time.Date(2024, 3, 20, 18, 0, 0, 0, time.UTC)
+	tasks := []todo.Task{
+		{ID: "a", Title: "Buy milk", Deadline: &late, ListID: "shopping"},
+		{ID: "b", Title: "buy bread", Deadline: &early, Done: true, ListID: "shopping"},
+		{ID: "c", Title: "Walk the dog", OwnerID: "alice"},
+		{ID: "d", Title: "Call mom", Done: true},
+	}
+	for _, task := range tasks {
+		if _, err := s.Upsert(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ptr := func(id todo.ID) *todo.ID { return &id }
+	shopping := todo.ListID("shopping")
+	alice, nobody := todo.UserID("alice"), todo.UserID("")
+	yes, no := true, false
+	tt := map[string]struct {
+		filter   *todo.TaskFilter
+		expected []todo.ID
+	}{
+		"nil filter": {
+			expected: []todo.ID{"a", "b", "c", "d"},
+		},
+		"by id": {
+			filter:   &todo.TaskFilter{ID: ptr("c")},
+			expected: []todo.ID{"c"},
+		},
+		"by id is not a pattern": {
+			filter:   &todo.TaskFilter{ID: ptr("%")},
+			expected: []todo.ID{},
+		},
+		"by list": {
+			filter:   &todo.TaskFilter{ListID: &shopping},
+			expected: []todo.ID{"a", "b"},
+		},
+		"by owner": {
+			filter:   &todo.TaskFilter{OwnerID: &alice},
+			expected: []todo.ID{"c"},
+		},
+		"without owner": {
+			filter:   &todo.TaskFilter{OwnerID: &nobody},
+			expected: []todo.ID{"a", "b", "d"},
+		},
+		"done": {
+			filter:   &todo.TaskFilter{Done: &yes},
+			expected: []todo.ID{"b", "d"},
+		},
+		"undone": {
+			filter:   &todo.TaskFilter{Done: &no},
+			expected: []todo.ID{"a", "c"},
+		},
+		"deadline before": {
+			filter:   &todo.TaskFilter{DeadlineBefore: &late},
+			expected: []todo.ID{"b"},
+		},
+		"deadline after": {
+			filter:   &todo.TaskFilter{DeadlineAfter: &early},
+			expected: []todo.ID{"a"},
+		},
+		"title contains, case-insensitive": {
+			filter:   &todo.TaskFilter{TitleContains: "BUY"},
+			expected: []todo.ID{"a", "b"},
+		},
+		"all criteria at once": {
+			filter:   &todo.TaskFilter{Done: &no, TitleContains: "milk", DeadlineAfter: &early},
+			expected: []todo.ID{"a"},
+		},
+		"sorted by title": {
+			filter:   &todo.TaskFilter{SortBy: todo.SortByTitle},
+			expected: []todo.ID{"b", "a", "d", "c"},
+		},
+		"sorted by deadline, tasks without deadline last": {
+			filter:   &todo.TaskFilter{SortBy: todo.SortByDeadline},
+			expected: []todo.ID{"b", "a", "c", "d"},
+		},
+		"sorted by deadline descending": {
+			filter:   &todo.TaskFilter{SortBy: todo.SortByDeadline, Descending: true},
+			expected: []todo.ID{"d", "c", "a", "b"},
+		},
+		"first page": {
+			filter:   &todo.TaskFilter{SortBy: todo.SortByTitle, Limit: 2},
+			expected: []todo.ID{"b", "a"},
+		},
+		"second page": {
+			filter:   &todo.TaskFilter{SortBy: todo.SortByTitle, Limit: 2, After: ptr("a")},
+			expected: []todo.ID{"d", "c"},
+		},
+		"second page descending": {
+			filter:   &todo.TaskFilter{SortBy: todo.SortByDeadline, Descending: true, Limit: 2, After: ptr("c")},
+			expected: []todo.ID{"a", "b"},
+		},
+		"cursor of unknown task": {
+			filter:   &todo.TaskFilter{After: ptr("missing")},
+			expected: []todo.ID{},
+		},
+	}
+
+	for name, tc := range tt {
+		t.Run(name, func(t *testing.T) {
+			if ids := ids(list(t, s, tc.filter)); !slices.Equal(tc.expected, ids) {
+				t.Errorf("expected: %v, got: %v", tc.expected, ids)
+			}
+		})
+	}
+}
+
+func notFound(t *testing.T, s todo.Storage) {
+	ctx := context.Background()
+
+	if _, err := s.Toggle(ctx, "missing", 0); !errors.Is(err, todo.ErrTaskNotFound) {
+		t.Errorf("toggle, expected: %v, got: %v", todo.ErrTaskNotFound, err)
+	}
+
+	if err := s.Delete(ctx, "missing", 0); !errors.Is(err, todo.ErrTaskNotFound) {
+		t.Errorf("delete, expected: %v, got: %v", todo.ErrTaskNotFound, err)
+	}
+
+	id := todo.ID("missing")
+	if found := list(t, s, &todo.TaskFilter{ID: &id}); len(found) != 0 {
+		t.Errorf("expected no tasks, got: %v", found)
+	}
+
+	_, err := todo.NewHandler(s, nil, nil).Get(ctx, id)
+	if !errors.Is(err, todo.ErrTaskNotFound) {
+		t.Errorf("get, expected: %v, got: %v", todo.ErrTaskNotFound, err)
+	}
+}
+
+func deadline(t *testing.T, s todo.Storage) {
+	ctx := context.Background()
+
+	tt := map[string]time.Time{
+		"UTC":              time.Date(2024, 3, 20, 18, 0, 0, 0, time.UTC),
+		"winter in Warsaw": time.Date(2024, 1, 20, 18, 0, 0, 0, location(t, "Europe/Warsaw")),
+		"summer in Warsaw": time.Date(2024, 7, 20, 18, 0, 0, 0, location(t, "Europe/Warsaw")),
+		"New York":         time.Date(2024, 3, 20, 9, 15, 30, 0, location(t, "America/New_York")),
+		"half hour offset": time.Date(2024, 3, 20, 23, 45, 0, 0, location(t, "Asia/Kolkata")),
+	}
+
+	for name, d := range tt {
+		t.Run(name, func(t *testing.T) {
+			id := todo.ID(name)
+			stored, err := s.Upsert(ctx, todo.Task{ID: id, Title: name, Deadline: &d})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for source, task := range map[string]todo.Task{"upserted": stored, "listed": get(t, s, id)} {
+				if task.Deadline == nil || !task.Deadline.Equal(d) {
+					t.Errorf("%s deadline: %v should be equal to: %s", source, task.Deadline, d)
+					continue
+				}
+
+				_, expected := d.Zone()
+				if _, offset := task.Deadline.Zone(); offset != expected {
+					t.Errorf("%s deadline should keep the offset: %d, got: %d", source, expected, offset)
+				}
+			}
+		})
+	}
+
+	t.Run("sub-second precision is dropped", func(t *testing.T) {
+		d := time.Date(2024, 3, 20, 18, 0, 0, 999, time.UTC)
+		if _, err := s.Upsert(ctx, todo.Task{ID: "precise", Title: "precise", Deadline: &d}); err != nil {
+			t.Fatal(err)
+		}
+
+		if found := get(t, s, "precise"); !found.Deadline.Equal(d.Truncate(time.Second)) {
+			t.Errorf("expected deadline: %s, got: %s", d.Truncate(time.Second), found.Deadline)
+		}
+	})
+
+	t.Run("deadline can not be modified through the returned pointer", func(t *testing.T) {
+		d := time.Date(2024, 3, 20, 18, 0, 0, 0, time.UTC)
+		stored, err := s.Upsert(ctx, todo.Task{ID: "aliased", Title: "aliased", Deadline: &d})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d = d.Add(time.Hour)
+		*stored.Deadline = stored.Deadline.Add(time.Hour)
+
+		if found := get(t, s, "aliased"); !found.Deadline.Equal(time.Date(2024, 3, 20, 18, 0, 0, 0, time.UTC)) {
+			t.Errorf("stored deadline has been modified: %s", found.Deadline)
+		}
+	})
+
+	t.Run("no deadline", func(t *testing.T) {
+		if _, err := s.Upsert(ctx, todo.Task{ID: "none", Title: "none"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if found := get(t, s, "none"); found.Deadline != nil {
+			t.Errorf("expected no deadline, got: %s", found.Deadline)
+		}
+	})
+}
+
+func cancelled(t *testing.T, s todo.Storage) {
+	if _, err := s.Upsert(context.Background(), todo.Task{ID: "a", Title: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cf := context.WithCancel(context.Background())
+	cf()
+
+	_, err := s.Upsert(ctx, todo.Task{ID: "b", Title: "b"})
+	assertCancelled(t, "upsert", err)
+
+	_, err = s.List(ctx, nil)
+	assertCancelled(t, "list", err)
+
+	_, err = s.Toggle(ctx, "a", 0)
+	assertCancelled(t, "toggle", err)
+
+	err = s.Delete(ctx, "a", 0)
+	assertCancelled(t, "delete", err)
+
+	if found := list(t, s, nil); len(found) != 1 || found[0].Version != 1 {
+		t.Errorf("cancelled operations must not change the tasks, got: %v", found)
+	}
+}
+
+func assertCancelled(t *testing.T, op string, err error) {
+	t.Helper()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("%s with cancelled context, expected: %v, got: %v", op, context.Canceled, err)
+	}
+}
+
+func concurrency(t *testing.T, s todo.Storage) {
+	ctx := context.Background()
+	if _, err := s.Upsert(ctx, todo.Task{ID: "toggled", Title: "toggled"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// every toggle must be applied, even when a user double-clicks the checkbox
+	const workers = 51
+	wg := sync.WaitGroup{}
+	wg.Add(3 * workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			if _, err := s.Toggle(ctx, "toggled", 0); err != nil {
+				t.Errorf("toggling the task, %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := s.Upsert(ctx, todo.Task{ID: todo.RandomID(), Title: "created concurrently"}); err != nil {
+				t.Errorf("creating the task, %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := s.List(ctx, nil); err != nil {
+				t.Errorf("listing the tasks, %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if found := get(t, s, "toggled"); !found.Done || found.Version != workers+1 {
+		t.Errorf("task toggled %d times should be done in version: %d, got: %+v", workers, workers+1, found)
+	}
+
+	if found := list(t, s, nil); len(found) != workers+1 {
+		t.Errorf("expected %d tasks, got: %d", workers+1, len(found))
+	}
+}
+
+// count verifies the storages implementing todo.TaskCounter
+func count(t *testing.T, s todo.Storage) {
+	counter, ok := s.(todo.TaskCounter)
+	if !ok {
+		t.Skip("the storage does not count tasks")
+	}
+
+	ctx := context.Background()
+	for _, task := range []todo.Task{
+		{ID: "a", Title: "a", Done: true, OwnerID: "1"},
+		{ID: "b", Title: "b", OwnerID: "2"},
+		{ID: "c", Title: "c"},
+	} {
+		if _, err := s.Upsert(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done, undone, err := counter.CountTasks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if done != 1 || undone != 2 {
+		t.Errorf("expected 1 done and 2 undone tasks of all users, got: %d done, %d undone", done, undone)
+	}
+}
+
+// history verifies the storages implementing todo.HistoryStorage
+func history(t *testing.T, s todo.Storage) {
+	hs, ok := s.(todo.HistoryStorage)
+	if !ok {
+		t.Skip("the storage does not record the history")
+	}
+
+	alice := todo.User{ID: "alice", Name: "Alice"}
+	ctx := todo.WithUser(context.Background(), alice)
+	deadline := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	created, err := s.Upsert(ctx, todo.Task{ID: "a", Title: "first", OwnerID: alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created.Title = "renamed"
+	created.Deadline = &deadline
+	updated, err := s.Upsert(ctx, created)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Toggle(ctx, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// a rejected write leaves no trace in the history
+	if _, err = s.Upsert(ctx, created); !errors.Is(err, todo.ErrStaleTask) {
+		t.Fatalf("expected: %v, got: %v", todo.ErrStaleTask, err)
+	}
+
+	if err = s.Delete(ctx, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := hs.History(ctx, "a", alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []todo.ChangeKind{todo.ChangeCreated, todo.ChangeRenamed, todo.ChangeDeadlineChanged, todo.ChangeToggled, todo.ChangeDeleted}
+	kinds := make([]todo.ChangeKind, 0, len(changes))
+	for _, c := range changes {
+		kinds = append(kinds, c.Kind)
+	}
+
+	if !slices.Equal(kinds, expected) {
+		t.Fatalf("expected changes: %v, got: %v", expected, kinds)
+	}
+
+	renamed, deleted := changes[1], changes[4]
+	if renamed.Title != "renamed" || renamed.Version != updated.Version || renamed.ActorID != alice.ID || renamed.Actor != alice.Name {
+		t.Errorf("unexpected change: %+v", renamed)
+	}
+
+	if d := changes[2].Deadline; d == nil || !d.Equal(deadline) {
+		t.Errorf("expected the deadline: %s after the change, got: %v", deadline, d)
+	}
+
+	if !deleted.Done || deleted.At.IsZero() || time.Since(deleted.At) > time.Minute {
+		t.Errorf("expected the last state of the task at the time of deletion, got: %+v", deleted)
+	}
+
+	if others, err := hs.History(ctx, "a", "mallory"); err != nil || len(others) != 0 {
+		t.Errorf("expected the history to be accessible only to the owner, got: %v, %v", others, err)
+	}
+}
+
+func get(t *testing.T, s todo.Storage, id todo.ID) todo.Task {
+	t.Helper()
+	found := list(t, s, &todo.TaskFilter{ID: &id})
+	if len(found) != 1 {
+		t.Fatalf("expected to find one task by id: %s, found: %d", id, len(found))
+	}
+
+	return found[0]
+}
+
+func list(t *testing.T, s todo.Storage, f *todo.TaskFilter) []todo.Task {
+	t.Helper()
+	found, err := s.List(context.Background(), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return found
+}
+
+func ids(tasks []todo.Task) []todo.ID {
+	out := make([]todo.ID, 0, len(tasks))
+	for _, task := range tasks {
+		out = append(out, task.ID)
+	}
+
+	return out
+}
+
+func location(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return loc
+}
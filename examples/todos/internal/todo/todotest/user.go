@@ -0,0 +1,179 @@
+package todotest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"todo/internal/todo"
+)
+
+// ShouldBehaveLikeUserStorage runs the behavioural suite of todo.UserStorage.
+// Every subtest gets its own storage from newStorage, which contains no users.
+func ShouldBehaveLikeUserStorage(t *testing.T, newStorage func(t *testing.T) todo.UserStorage) {
+	alice := todo.User{ID: "1", Name: "Alice", PasswordHash: []byte("hash")}
+	bob := todo.User{ID: "2", Name: "Bob", PasswordHash: []byte("other")}
+
+	t.Run("create", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+
+		if err := s.CreateUser(ctx, alice); err != nil {
+			t.Fatal(err)
+		}
+
+		found, err := s.UserByName(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found.ID != alice.ID || found.Name != alice.Name || !bytes.Equal(found.PasswordHash, alice.PasswordHash) {
+			t.Errorf("expected: %+v, got: %+v", alice, found)
+		}
+	})
+
+	t.Run("names are unique case-insensitive", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+
+		if err := s.CreateUser(ctx, alice); err != nil {
+			t.Fatal(err)
+		}
+
+		err := s.CreateUser(ctx, todo.User{ID: "2", Name: "ALICE", PasswordHash: []byte("other")})
+		if !errors.Is(err, todo.ErrUserExists) {
+			t.Errorf("expected: %v, got: %v", todo.ErrUserExists, err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		if _, err := newStorage(t).UserByName(context.Background(), "bob"); !errors.Is(err, todo.ErrUserNotFound) {
+			t.Errorf("expected: %v, got: %v", todo.ErrUserNotFound, err)
+		}
+	})
+
+	t.Run("session", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+
+		if err := s.CreateUser(ctx, alice); err != nil {
+			t.Fatal(err)
+		}
+
+		expires := time.Date(2024, 3, 20, 18, 0, 0, 0, time.UTC)
+		if err := s.CreateSession(ctx, todo.Session{TokenHash: "token", UserID: alice.ID, ExpiresAt: expires}, expires.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := s.SessionUser(ctx, "token", expires.Add(-time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if u.ID != alice.ID {
+			t.Errorf("expected user: %s, got: %+v", alice.ID, u)
+		}
+
+		for name, tc := range map[string]struct {
+			token string
+			now   time.Time
+		}{
+			"expired":       {token: "token", now: expires},
+			"unknown token": {token: "other", now: expires.Add(-time.Second)},
+		} {
+			t.Run(name, func(t *testing.T) {
+				if _, err := s.SessionUser(ctx, tc.token, tc.now); !errors.Is(err, todo.ErrSessionNotFound) {
+					t.Errorf("expected: %v, got: %v", todo.ErrSessionNotFound, err)
+				}
+			})
+		}
+
+		t.Run("expired are removed on creation", func(t *testing.T) {
+			next := todo.Session{TokenHash: "next", UserID: alice.ID, ExpiresAt: expires.Add(time.Hour)}
+			if err := s.CreateSession(ctx, next, expires); err != nil {
+				t.Fatal(err)
+			}
+
+			// looked up before the expiry, so only the removal can hide it
+			if _, err := s.SessionUser(ctx, "token", expires.Add(-time.Second)); !errors.Is(err, todo.ErrSessionNotFound) {
+				t.Errorf("expected: %v, got: %v", todo.ErrSessionNotFound, err)
+			}
+
+			if _, err := s.SessionUser(ctx, "next", expires); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("deleted", func(t *testing.T) {
+			if err := s.DeleteSession(ctx, "next"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := s.SessionUser(ctx, "next", expires); !errors.Is(err, todo.ErrSessionNotFound) {
+				t.Errorf("expected: %v, got: %v", todo.ErrSessionNotFound, err)
+			}
+		})
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		s := newStorage(t)
+		ctx := context.Background()
+
+		for _, u := range []todo.User{alice, bob} {
+			if err := s.CreateUser(ctx, u); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		created := time.Date(2024, 3, 20, 18, 0, 0, 0, time.UTC)
+		tokens := []todo.Token{
+			{ID: "b", UserID: alice.ID, Name: "backup", Scope: todo.ScopeRead, Hash: "hash-b", CreatedAt: created.Add(time.Minute)},
+			{ID: "a", UserID: alice.ID, Name: "ci", Scope: todo.ScopeWrite, Hash: "hash-a", CreatedAt: created},
+			{ID: "c", UserID: bob.ID, Name: "other", Scope: todo.ScopeWrite, Hash: "hash-c", CreatedAt: created},
+		}
+		for _, tok := range tokens {
+			if err := s.CreateToken(ctx, tok); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		listed, err := s.Tokens(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(listed) != 2 || listed[0] != tokens[1] || !listed[0].CreatedAt.Equal(created) || listed[1].ID != "b" {
+			t.Errorf("expected tokens of the user in order of creation, got: %+v", listed)
+		}
+
+		found, u, err := s.TokenByHash(ctx, "hash-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found.ID != "a" || found.Scope != todo.ScopeWrite || u.ID != alice.ID {
+			t.Errorf("unexpected token: %+v of user: %+v", found, u)
+		}
+
+		t.Run("token of other user can not be revoked", func(t *testing.T) {
+			if err := s.DeleteToken(ctx, alice.ID, "c"); !errors.Is(err, todo.ErrTokenNotFound) {
+				t.Errorf("expected: %v, got: %v", todo.ErrTokenNotFound, err)
+			}
+		})
+
+		t.Run("revoked", func(t *testing.T) {
+			if err := s.DeleteToken(ctx, alice.ID, "a"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := s.TokenByHash(ctx, "hash-a"); !errors.Is(err, todo.ErrTokenNotFound) {
+				t.Errorf("expected: %v, got: %v", todo.ErrTokenNotFound, err)
+			}
+
+			if err := s.DeleteToken(ctx, alice.ID, "a"); !errors.Is(err, todo.ErrTokenNotFound) {
+				t.Errorf("expected: %v, got: %v", todo.ErrTokenNotFound, err)
+			}
+		})
+	})
+}
@@ -0,0 +1,142 @@
+package todo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type TokenID string
+
+func (i TokenID) String() string {
+	return "TokenID[" + string(i) + "]"
+}
+
+// Scope limits what can be done with a token.
+type Scope string
+
+const (
+	ScopeRead Scope = "read"
+	// ScopeWrite allows reading too
+	ScopeWrite Scope = "write"
+)
+
+// Token is a personal access token, which lets scripts act on behalf of the user without logging in.
+// Like a session, only a hash of the secret is stored, the secret itself is shown just once when the token is created.
+type Token struct {
+	ID        TokenID   `json:"id"`
+	UserID    UserID    `json:"-"`
+	Name      string    `json:"name"`
+	Scope     Scope     `json:"scope"`
+	Hash      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// tokenPrefix makes the secrets easy to recognize by secret scanners
+const tokenPrefix = "todo_"
+
+// CreateToken returns the stored token along with its secret, which is not stored anywhere.
+func (h *Handler) CreateToken(ctx context.Context, cmd CreateToken) (Token, string, error) {
+	err := cmd.Validate()
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	u, ok := UserFromContext(ctx)
+	if !ok {
+		return Token{}, "", fmt.Errorf("tokens can be created only by a user, %w", ErrInvalidToken)
+	}
+
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return Token{}, "", fmt.Errorf("generating token secret, %w", err)
+	}
+
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	t := Token{
+		ID:        TokenID(RandomID()),
+		UserID:    u.ID,
+		Name:      cmd.Name,
+		Scope:     cmd.Scope,
+		Hash:      hashToken(secret),
+		CreatedAt: time.Now().Truncate(time.Second),
+	}
+
+	err = h.u.CreateToken(ctx, t)
+	if err != nil {
+		return Token{}, "", fmt.Errorf("creating token: %s of user: %s, %w", t.Name, u.ID, err)
+	}
+
+	return t, secret, nil
+}
+
+// Tokens returns the tokens of the user of the context.
+func (h *Handler) Tokens(ctx context.Context) ([]Token, error) {
+	o := owner(ctx)
+	tokens, err := h.u.Tokens(ctx, o)
+	if err != nil {
+		return nil, fmt.Errorf("listing tokens of: %s, %w", o, err)
+	}
+
+	return tokens, nil
+}
+
+// RevokeToken deletes the token of the user of the context. It returns ErrTokenNotFound if the user has no such token.
+func (h *Handler) RevokeToken(ctx context.Context, id TokenID) error {
+	o := owner(ctx)
+	err := h.u.DeleteToken(ctx, o, id)
+	if err != nil {
+		return fmt.Errorf("revoking token: %s of: %s, %w", id, o, err)
+	}
+
+	return nil
+}
+
+// AuthenticateToken returns the token of the secret with its user or ErrTokenNotFound if the token was revoked.
+func (h *Handler) AuthenticateToken(ctx context.Context, secret string) (Token, User, error) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return Token{}, User{}, fmt.Errorf("token without prefix: %s, %w", tokenPrefix, ErrTokenNotFound)
+	}
+
+	t, u, err := h.u.TokenByHash(ctx, hashToken(secret))
+	if err != nil {
+		return Token{}, User{}, fmt.Errorf("getting the token, %w", err)
+	}
+
+	return t, u, nil
+}
+
+type CreateToken struct {
+	Name  string
+	Scope Scope
+}
+
+func (c CreateToken) Validate() error {
+	if len(strings.TrimSpace(c.Name)) == 0 {
+		return fmt.Errorf("name must not be blank, %w", ErrInvalidToken)
+	}
+
+	if n := utf8.RuneCountInString(c.Name); n > MaxNameLength {
+		return fmt.Errorf("name must have at most %d characters, has: %d, %w", MaxNameLength, n, ErrInvalidToken)
+	}
+
+	switch c.Scope {
+	case ScopeRead, ScopeWrite:
+	default:
+		return fmt.Errorf("unsupported scope: %s, %w", c.Scope, ErrInvalidToken)
+	}
+
+	return nil
+}
+
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrInvalidToken is returned when a token command does not pass the validation.
+	ErrInvalidToken = errors.New("invalid token")
+)
@@ -0,0 +1,205 @@
+package todo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type UserID string
+
+func (i UserID) String() string {
+	return "UserID[" + string(i) + "]"
+}
+
+// User owns the tasks, nobody else can see or change them.
+type User struct {
+	ID   UserID `json:"id"`
+	Name string `json:"name"`
+	// PasswordHash is a bcrypt hash, the password itself is never stored
+	PasswordHash []byte `json:"-"`
+}
+
+// Session is created by logging in. Only a hash of its token is stored, so a leaked database can not be used to log in.
+type Session struct {
+	TokenHash string
+	UserID    UserID
+	ExpiresAt time.Time
+}
+
+// UserStorage keeps the users along with the ways they authenticate: sessions and tokens.
+type UserStorage interface {
+	// CreateUser returns ErrUserExists if there is a user with the same name, compared case-insensitive.
+	CreateUser(ctx context.Context, u User) error
+	// UserByName returns ErrUserNotFound if there is no such user.
+	UserByName(ctx context.Context, name string) (User, error)
+	// CreateSession also removes the sessions, which have expired at the given time.
+	CreateSession(ctx context.Context, s Session, now time.Time) error
+	// SessionUser returns the user of the session, which has not expired at the given time, or ErrSessionNotFound.
+	SessionUser(ctx context.Context, tokenHash string, now time.Time) (User, error)
+	// DeleteSession does nothing if there is no such session.
+	DeleteSession(ctx context.Context, tokenHash string) error
+	CreateToken(ctx context.Context, t Token) error
+	// Tokens returns the tokens of the user ordered by the time of creation.
+	Tokens(ctx context.Context, user UserID) ([]Token, error)
+	// TokenByHash returns the token with its user or ErrTokenNotFound.
+	TokenByHash(ctx context.Context, hash string) (Token, User, error)
+	// DeleteToken returns ErrTokenNotFound if the user has no such token.
+	DeleteToken(ctx context.Context, user UserID, id TokenID) error
+}
+
+// SessionTTL is how long the user stays logged in.
+const SessionTTL = 7 * 24 * time.Hour
+
+type userKey struct{}
+
+// WithUser returns the context of a request made by the user.
+// Tasks are created, listed and changed on behalf of the user of the context.
+func WithUser(ctx context.Context, u User) context.Context {
+	return context.WithValue(ctx, userKey{}, u)
+}
+
+// UserFromContext returns the user set with WithUser.
+func UserFromContext(ctx context.Context) (User, bool) {
+	u, ok := ctx.Value(userKey{}).(User)
+	return u, ok
+}
+
+// owner of the tasks accessed with the context, tasks created without a user have no owner
+func owner(ctx context.Context) UserID {
+	u, _ := UserFromContext(ctx)
+	return u.ID
+}
+
+func (h *Handler) Register(ctx context.Context, cmd Register) (User, error) {
+	err := cmd.Validate()
+	if err != nil {
+		return User{}, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(cmd.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, fmt.Errorf("hashing the password, %w", err)
+	}
+
+	u := User{ID: UserID(RandomID()), Name: cmd.Name, PasswordHash: hash}
+	err = h.u.CreateUser(ctx, u)
+	if err != nil {
+		return User{}, fmt.Errorf("creating user: %s, %w", u.Name, err)
+	}
+
+	return u, nil
+}
+
+// dummyHash is compared when there is no such user, so the response takes the same time and does not reveal registered names.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// Login returns a token of a new session. It returns ErrInvalidCredentials if there is no such user or the password does not match.
+func (h *Handler) Login(ctx context.Context, name, password string) (token string, u User, err error) {
+	u, err = h.u.UserByName(ctx, name)
+	if errors.Is(err, ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return "", User{}, fmt.Errorf("user: %s, %w", name, ErrInvalidCredentials)
+	}
+
+	if err != nil {
+		return "", User{}, fmt.Errorf("getting user: %s to log in, %w", name, err)
+	}
+
+	err = bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password))
+	if err != nil {
+		return "", User{}, fmt.Errorf("password of user: %s, %w", name, ErrInvalidCredentials)
+	}
+
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", User{}, fmt.Errorf("generating session token, %w", err)
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	err = h.u.CreateSession(ctx, Session{TokenHash: hashToken(token), UserID: u.ID, ExpiresAt: now.Add(SessionTTL)}, now)
+	if err != nil {
+		return "", User{}, fmt.Errorf("creating session of user: %s, %w", u.ID, err)
+	}
+
+	return token, u, nil
+}
+
+// Authenticate returns the user logged in with the session token or ErrSessionNotFound if the session expired.
+func (h *Handler) Authenticate(ctx context.Context, token string) (User, error) {
+	u, err := h.u.SessionUser(ctx, hashToken(token), time.Now())
+	if err != nil {
+		return User{}, fmt.Errorf("getting user of the session, %w", err)
+	}
+
+	return u, nil
+}
+
+func (h *Handler) Logout(ctx context.Context, token string) error {
+	err := h.u.DeleteSession(ctx, hashToken(token))
+	if err != nil {
+		return fmt.Errorf("deleting the session, %w", err)
+	}
+
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type Register struct {
+	Name     string
+	Password string
+}
+
+const (
+	// MinPasswordLength is the minimum number of characters in a password.
+	MinPasswordLength = 8
+	// MaxPasswordBytes is the limit of bcrypt, longer passwords would be silently truncated.
+	MaxPasswordBytes = 72
+)
+
+func (c Register) Validate() error {
+	if len(strings.TrimSpace(c.Name)) == 0 {
+		return fmt.Errorf("name must not be blank, %w", ErrInvalidUser)
+	}
+
+	if n := utf8.RuneCountInString(c.Name); n > MaxNameLength {
+		return fmt.Errorf("name must have at most %d characters, has: %d, %w", MaxNameLength, n, ErrInvalidUser)
+	}
+
+	if n := utf8.RuneCountInString(c.Password); n < MinPasswordLength {
+		return fmt.Errorf("password must have at least %d characters, has: %d, %w", MinPasswordLength, n, ErrInvalidUser)
+	}
+
+	if n := len(c.Password); n > MaxPasswordBytes {
+		return fmt.Errorf("password must have at most %d bytes, has: %d, %w", MaxPasswordBytes, n, ErrInvalidUser)
+	}
+
+	return nil
+}
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when registering a name, which is already taken.
+	ErrUserExists = errors.New("user already exists")
+	// ErrInvalidUser is returned when a registration does not pass the validation.
+	ErrInvalidUser = errors.New("invalid user")
+	// ErrInvalidCredentials is returned when logging in with unknown name or wrong password.
+	ErrInvalidCredentials = errors.New("invalid name or password")
+	// ErrSessionNotFound is returned when the session token is unknown or expired.
+	ErrSessionNotFound = errors.New("session not found")
+)
@@ -1,5 +0,0 @@
-function taskToggled(id) {
-    var xhr = new XMLHttpRequest();
-    xhr.open("PUT", "/api/todos/" + id + "/toggle", true);
-    xhr.send();
-}
\ No newline at end of file